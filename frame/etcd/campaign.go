@@ -38,13 +38,21 @@ for {
 }
 */
 func Campaign(ctx context.Context, prefix string, val string, ttl int) (<-chan bool, error) {
+	return Default().Campaign(ctx, prefix, val, ttl)
+}
+
+// Campaign 参考包级别的Campaign
+func (c *Client) Campaign(ctx context.Context, prefix string, val string, ttl int) (<-chan bool, error) {
+	if c == nil || c.Client == nil {
+		return nil, ErrClientNotInit
+	}
 	leader := make(chan bool)
 	go func() {
 		defer close(leader) // 退出时关闭
 		for {
 			// step1: 创建租约
 			// session中keepAlive会一直续租，如果续租失败，session.Done()会收到退出信号
-			session, err := NewSession(concurrency.WithTTL(ttl))
+			session, err := c.NewSession(concurrency.WithTTL(ttl))
 			if err != nil {
 				continue
 			}
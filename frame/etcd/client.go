@@ -1,3 +1,18 @@
+// etcd client
+/*
+Client 是 clientv3.Client 的简单封装，Session、Locker、Election、Service、Discovery、Campaign 都从 Client 创建，
+一个进程可以同时连接多个集群，单元测试也可以为每个组件传入独立的 client。
+包级别的同名函数使用 InitDefaultClient 初始化的默认 client，仅为方便使用:
+
+	client, err := etcd.NewClient(&clientv3.Config{Endpoints: []string{"127.0.0.1:2379"}})
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	locker, err := client.NewLocker("/lock/job", 10)
+	election, err := client.NewElection("/election/app", hostname, 10, cbs)
+*/
 package etcd
 
 import (
@@ -7,6 +22,36 @@ import (
 	"go.etcd.io/etcd/client/v3/concurrency"
 )
 
+var ErrClientNotInit = errors.New("client not init")
+
+type Client struct {
+	*clientv3.Client
+}
+
+// NewClient 根据配置创建Client
+func NewClient(cfg *clientv3.Config) (*Client, error) {
+	client, err := clientv3.New(*cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{Client: client}, nil
+}
+
+// WrapClient 使用已有的clientv3.Client
+func WrapClient(client *clientv3.Client) *Client {
+	return &Client{Client: client}
+}
+
+// NewSession 创建一个lease，默认是60s TTL，并会调用KeepAlive，
+// 永久为这个lease自动续约（2/3生命周期的时候执行续约操作）
+// e.g. client.NewSession(concurrency.WithTTL(5))
+func (c *Client) NewSession(opts ...concurrency.SessionOption) (*concurrency.Session, error) {
+	if c == nil || c.Client == nil {
+		return nil, ErrClientNotInit
+	}
+	return concurrency.NewSession(c.Client, opts...)
+}
+
 var defaultClient *clientv3.Client
 
 // InitDefaultClient 初始化
@@ -19,18 +64,26 @@ func InitDefaultClient(cfg *clientv3.Config) error {
 	return nil
 }
 
+// SetDefaultClient 设置默认client
+func SetDefaultClient(client *Client) {
+	if client == nil {
+		defaultClient = nil
+		return
+	}
+	defaultClient = client.Client
+}
+
 // GetDefaultClient 获取默认client
 func GetDefaultClient() *clientv3.Client {
 	return defaultClient
 }
 
-// NewSession 创建一个lease，默认是60s TTL，并会调用KeepAlive，
-// 永久为这个lease自动续约（2/3生命周期的时候执行续约操作）
-// e.g. NewSession(concurrency.WithTTL(5))
+// Default 获取默认client的封装，未初始化时创建的组件返回ErrClientNotInit
+func Default() *Client {
+	return &Client{Client: defaultClient}
+}
+
+// NewSession 使用默认client创建session
 func NewSession(opts ...concurrency.SessionOption) (*concurrency.Session, error) {
-	client := GetDefaultClient()
-	if client == nil {
-		return nil, errors.New("client not init")
-	}
-	return concurrency.NewSession(client, opts...)
+	return Default().NewSession(opts...)
 }
@@ -0,0 +1,20 @@
+package etcd
+
+import (
+	"context"
+	"testing"
+)
+
+func TestClientNotInit(t *testing.T) {
+	SetDefaultClient(nil)
+
+	if _, err := NewLocker("/lock/test", 5); err != ErrClientNotInit {
+		t.Fatalf("NewLocker err = %v, want ErrClientNotInit", err)
+	}
+	if _, err := (&Client{}).NewDiscovery("/services", 5, DiscoveryCallbacks{}); err != ErrClientNotInit {
+		t.Fatalf("NewDiscovery err = %v, want ErrClientNotInit", err)
+	}
+	if _, err := Campaign(context.Background(), "/election", "a", 5); err != ErrClientNotInit {
+		t.Fatalf("Campaign err = %v, want ErrClientNotInit", err)
+	}
+}
@@ -0,0 +1,212 @@
+// etcd config
+/*
+从环境变量或YAML/JSON文件加载etcd连接配置，校验后创建Client:
+
+1、LoadConfig(path) 先读取文件（.json 为JSON，其他为YAML），再用环境变量覆盖，path为空时只读取环境变量
+2、TLS: 设置了 cert_file/key_file（双向认证）或 ca_file 时启用
+3、NewClient 阻塞直到连接成功或超过 dial_timeout
+
+	endpoints: ["https://10.0.0.1:2379", "https://10.0.0.2:2379"]
+	dial_timeout: 5s
+	username: app
+	password: secret
+	cert_file: /etc/etcd/client.pem
+	key_file: /etc/etcd/client-key.pem
+	ca_file: /etc/etcd/ca.pem
+	keepalive_time: 30s
+	keepalive_timeout: 10s
+	auto_sync_interval: 1m
+
+环境变量: ETCD_ENDPOINTS（逗号分隔）、ETCD_DIAL_TIMEOUT、ETCD_USERNAME、ETCD_PASSWORD、ETCD_CERT_FILE、
+ETCD_KEY_FILE、ETCD_CA_FILE、ETCD_KEEPALIVE_TIME、ETCD_KEEPALIVE_TIMEOUT、ETCD_AUTO_SYNC_INTERVAL
+
+	cfg, err := etcd.LoadConfig(os.Getenv("ETCD_CONFIG"))
+	if err != nil {
+		return err
+	}
+	client, err := cfg.NewClient()
+*/
+package etcd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.etcd.io/etcd/client/pkg/v3/transport"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"google.golang.org/grpc"
+	"gopkg.in/yaml.v3"
+)
+
+// Duration 支持 "5s"、"1m" 格式的时间
+type Duration time.Duration
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// Config etcd连接配置
+type Config struct {
+	Endpoints []string `json:"endpoints" yaml:"endpoints"`
+	// DialTimeout 连接超时，默认5s
+	DialTimeout Duration `json:"dial_timeout" yaml:"dial_timeout"`
+
+	Username string `json:"username" yaml:"username"`
+	Password string `json:"password" yaml:"password"`
+
+	// CertFile、KeyFile 客户端证书，CAFile 校验服务端证书的CA
+	CertFile string `json:"cert_file" yaml:"cert_file"`
+	KeyFile  string `json:"key_file" yaml:"key_file"`
+	CAFile   string `json:"ca_file" yaml:"ca_file"`
+
+	// KeepAliveTime 客户端keepalive探测间隔，为0时不探测
+	KeepAliveTime Duration `json:"keepalive_time" yaml:"keepalive_time"`
+	// KeepAliveTimeout keepalive探测的超时时间
+	KeepAliveTimeout Duration `json:"keepalive_timeout" yaml:"keepalive_timeout"`
+	// AutoSyncInterval 从集群同步endpoints的间隔，为0时不同步
+	AutoSyncInterval Duration `json:"auto_sync_interval" yaml:"auto_sync_interval"`
+}
+
+// LoadConfig 读取配置文件并使用环境变量覆盖，path为空时只读取环境变量
+func LoadConfig(path string) (*Config, error) {
+	cfg := &Config{DialTimeout: Duration(5 * time.Second)}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if strings.EqualFold(filepath.Ext(path), ".json") {
+			err = json.Unmarshal(data, cfg)
+		} else {
+			err = yaml.Unmarshal(data, cfg)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parse %s: %w", path, err)
+		}
+	}
+	if err := cfg.loadEnv(); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func (c *Config) loadEnv() error {
+	if v := os.Getenv("ETCD_ENDPOINTS"); v != "" {
+		c.Endpoints = strings.Split(v, ",")
+	}
+	for env, s := range map[string]*string{
+		"ETCD_USERNAME":  &c.Username,
+		"ETCD_PASSWORD":  &c.Password,
+		"ETCD_CERT_FILE": &c.CertFile,
+		"ETCD_KEY_FILE":  &c.KeyFile,
+		"ETCD_CA_FILE":   &c.CAFile,
+	} {
+		if v := os.Getenv(env); v != "" {
+			*s = v
+		}
+	}
+	for env, d := range map[string]*Duration{
+		"ETCD_DIAL_TIMEOUT":       &c.DialTimeout,
+		"ETCD_KEEPALIVE_TIME":     &c.KeepAliveTime,
+		"ETCD_KEEPALIVE_TIMEOUT":  &c.KeepAliveTimeout,
+		"ETCD_AUTO_SYNC_INTERVAL": &c.AutoSyncInterval,
+	} {
+		if v := os.Getenv(env); v != "" {
+			if err := d.UnmarshalText([]byte(v)); err != nil {
+				return fmt.Errorf("%s: %w", env, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Validate 校验配置
+func (c *Config) Validate() error {
+	if len(c.Endpoints) == 0 {
+		return errors.New("etcd config: no endpoints")
+	}
+	for i, endpoint := range c.Endpoints {
+		c.Endpoints[i] = strings.TrimSpace(endpoint)
+		if c.Endpoints[i] == "" {
+			return errors.New("etcd config: empty endpoint")
+		}
+	}
+	if c.DialTimeout <= 0 {
+		return errors.New("etcd config: dial_timeout must be positive")
+	}
+	if c.KeepAliveTime < 0 || c.KeepAliveTimeout < 0 || c.AutoSyncInterval < 0 {
+		return errors.New("etcd config: negative duration")
+	}
+	if (c.Username == "") != (c.Password == "") {
+		return errors.New("etcd config: username and password must be set together")
+	}
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return errors.New("etcd config: cert_file and key_file must be set together")
+	}
+	for _, file := range []string{c.CertFile, c.KeyFile, c.CAFile} {
+		if file == "" {
+			continue
+		}
+		if _, err := os.Stat(file); err != nil {
+			return fmt.Errorf("etcd config: %w", err)
+		}
+	}
+	return nil
+}
+
+// ClientConfig 转换为clientv3.Config
+func (c *Config) ClientConfig() (*clientv3.Config, error) {
+	cfg := &clientv3.Config{
+		Endpoints:            c.Endpoints,
+		DialTimeout:          time.Duration(c.DialTimeout),
+		Username:             c.Username,
+		Password:             c.Password,
+		DialKeepAliveTime:    time.Duration(c.KeepAliveTime),
+		DialKeepAliveTimeout: time.Duration(c.KeepAliveTimeout),
+		AutoSyncInterval:     time.Duration(c.AutoSyncInterval),
+		// 阻塞直到连接成功或超过DialTimeout
+		DialOptions: []grpc.DialOption{grpc.WithBlock()},
+	}
+	if c.CertFile != "" || c.CAFile != "" {
+		tlsInfo := transport.TLSInfo{
+			CertFile:      c.CertFile,
+			KeyFile:       c.KeyFile,
+			TrustedCAFile: c.CAFile,
+		}
+		tlsConfig, err := tlsInfo.ClientConfig()
+		if err != nil {
+			return nil, err
+		}
+		cfg.TLS = tlsConfig
+	}
+	return cfg, nil
+}
+
+// NewClient 校验配置并创建Client
+func (c *Config) NewClient() (*Client, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	cfg, err := c.ClientConfig()
+	if err != nil {
+		return nil, err
+	}
+	return NewClient(cfg)
+}
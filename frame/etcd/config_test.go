@@ -0,0 +1,106 @@
+package etcd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"frame/etcd/etcdtest"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	t.Setenv("ETCD_ENDPOINTS", "")
+	ca := writeFile(t, "ca.pem", "")
+
+	yamlPath := writeFile(t, "etcd.yaml", `
+endpoints: ["https://10.0.0.1:2379", "https://10.0.0.2:2379"]
+username: app
+password: secret
+ca_file: `+ca+`
+keepalive_time: 30s
+auto_sync_interval: 1m
+`)
+	jsonPath := writeFile(t, "etcd.json", `{
+	"endpoints": ["https://10.0.0.1:2379", "https://10.0.0.2:2379"],
+	"username": "app",
+	"password": "secret",
+	"ca_file": "`+ca+`",
+	"keepalive_time": "30s",
+	"auto_sync_interval": "1m"
+}`)
+	want := &Config{
+		Endpoints:        []string{"https://10.0.0.1:2379", "https://10.0.0.2:2379"},
+		DialTimeout:      Duration(5 * time.Second),
+		Username:         "app",
+		Password:         "secret",
+		CAFile:           ca,
+		KeepAliveTime:    Duration(30 * time.Second),
+		AutoSyncInterval: Duration(time.Minute),
+	}
+	for _, path := range []string{yamlPath, jsonPath} {
+		cfg, err := LoadConfig(path)
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		if !reflect.DeepEqual(cfg, want) {
+			t.Fatalf("%s: got %+v, want %+v", path, cfg, want)
+		}
+	}
+
+	// 环境变量覆盖文件
+	t.Setenv("ETCD_ENDPOINTS", "127.0.0.1:2379, 127.0.0.1:22379")
+	t.Setenv("ETCD_DIAL_TIMEOUT", "2s")
+	cfg, err := LoadConfig(yamlPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(cfg.Endpoints, []string{"127.0.0.1:2379", "127.0.0.1:22379"}) {
+		t.Fatalf("endpoints = %v", cfg.Endpoints)
+	}
+	if cfg.DialTimeout != Duration(2*time.Second) || cfg.Username != "app" {
+		t.Fatalf("got %+v", cfg)
+	}
+
+	t.Setenv("ETCD_DIAL_TIMEOUT", "2")
+	if _, err := LoadConfig(yamlPath); err == nil {
+		t.Fatal("invalid ETCD_DIAL_TIMEOUT accepted")
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	for name, cfg := range map[string]Config{
+		"no endpoints":   {DialTimeout: Duration(time.Second)},
+		"empty endpoint": {Endpoints: []string{" "}, DialTimeout: Duration(time.Second)},
+		"no timeout":     {Endpoints: []string{"127.0.0.1:2379"}},
+		"no password":    {Endpoints: []string{"127.0.0.1:2379"}, DialTimeout: Duration(time.Second), Username: "app"},
+		"no key":         {Endpoints: []string{"127.0.0.1:2379"}, DialTimeout: Duration(time.Second), CertFile: "client.pem"},
+		"missing ca":     {Endpoints: []string{"127.0.0.1:2379"}, DialTimeout: Duration(time.Second), CAFile: "/nonexistent/ca.pem"},
+	} {
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("%s: Validate() = nil", name)
+		}
+	}
+}
+
+func TestConfigNewClient(t *testing.T) {
+	cfg := &Config{Endpoints: []string{etcdtest.Start(t)}, DialTimeout: Duration(5 * time.Second)}
+	client, err := cfg.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if _, err := client.Put(context.Background(), "/test/config", "ok"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -6,6 +6,17 @@ https://qingwave.github.io/golang-distributed-system-x-etcd/
 1、创建 Session， Session 中 Lease 会自动续约
 2、服务注册时，在目录下创建对应的子目录，并附带 Lease
 3、通过 Watch 接口监听目录变化，同步到本地
+4、lease 丢失（网络分区、长时间GC）后，Service 按退避时间创建新的 lease 重新注册，通过 ServiceCallbacks 通知注册状态
+
+	service, err := client.NewService("/services/app/1", addr, 10)
+	service.Callbacks = etcd.ServiceCallbacks{
+		OnRegistered: func() { log.Println("registered") },
+		OnLost:       func() { log.Println("lease lost, re-registering") },
+	}
+	if err := service.Register(ctx); err != nil {
+		return err
+	}
+	defer service.Close()
 */
 package etcd
 
@@ -14,6 +25,7 @@ import (
 	"errors"
 	"strings"
 	"sync"
+	"time"
 
 	"go.etcd.io/etcd/api/v3/mvccpb"
 	clientv3 "go.etcd.io/etcd/client/v3"
@@ -33,33 +45,218 @@ type Service struct {
 	Key string
 	// 注册的value, e.g. ip address
 	Val string
+	// Callbacks 注册状态变化的回调，需要在Register之前设置
+	Callbacks ServiceCallbacks
+
+	ttl    int
+	client *Client
+	shared *SharedSession
+	// wake 共享session重建后立即重新注册
+	wake chan struct{}
 
-	ttl     int
+	mu      sync.Mutex
 	session *concurrency.Session
+	stop    chan struct{}
+	stopped chan struct{}
 }
 
+type ServiceCallbacks struct {
+	// OnRegistered 注册成功，包括lease丢失后的重新注册
+	OnRegistered func()
+	// OnLost lease丢失（网络分区、长时间GC等），注册的key已经或即将被删除，之后会自动重新注册
+	OnLost func()
+	// OnRegisterFailed 重新注册失败，按退避时间重试
+	OnRegisterFailed func(err error)
+}
+
+// NewService 使用默认client创建Service
 func NewService(key, val string, ttl int) (*Service, error) {
-	session, err := NewSession(concurrency.WithTTL(ttl))
+	return Default().NewService(key, val, ttl)
+}
+
+// NewService 创建Service
+func (c *Client) NewService(key, val string, ttl int) (*Service, error) {
+	session, err := c.NewSession(concurrency.WithTTL(ttl))
+	if err != nil {
+		return nil, err
+	}
+	return &Service{Key: key, Val: val, ttl: ttl, client: c, session: session}, nil
+}
+
+// NewService 创建使用共享session的Service
+func (m *SessionManager) NewService(key, val string, ttl int) (*Service, error) {
+	wake := make(chan struct{}, 1)
+	shared, err := m.Acquire(ttl, func(*concurrency.Session) {
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	})
 	if err != nil {
 		return nil, err
 	}
-	return &Service{Key: key, Val: val, ttl: ttl, session: session}, nil
+	return &Service{Key: key, Val: val, ttl: ttl, client: m.client, shared: shared, wake: wake, session: shared.Session()}, nil
 }
 
+// Register 注册服务，并在lease丢失后自动创建新的lease重新注册，直到UnRegister或Close
 func (s *Service) Register(ctx context.Context) error {
-	client := s.session.Client()
-	_, err := client.Put(ctx, s.Key, s.Val, clientv3.WithLease(s.session.Lease()))
+	s.mu.Lock()
+	// 共享session重建后使用新的lease注册
+	if s.shared != nil {
+		s.session = s.shared.Session()
+	}
+	if err := s.put(ctx, s.session); err != nil {
+		s.mu.Unlock()
+		return err
+	}
+	if s.stop == nil {
+		s.stop, s.stopped = make(chan struct{}), make(chan struct{})
+		go s.keep(s.session, s.stop, s.stopped)
+	}
+	s.mu.Unlock()
+
+	if s.Callbacks.OnRegistered != nil {
+		s.Callbacks.OnRegistered()
+	}
+	return nil
+}
+
+func (s *Service) put(ctx context.Context, session *concurrency.Session) error {
+	_, err := session.Client().Put(ctx, s.Key, s.Val, clientv3.WithLease(session.Lease()))
 	return err
 }
 
+// keep session结束后重新注册
+func (s *Service) keep(session *concurrency.Session, stop, stopped chan struct{}) {
+	defer close(stopped)
+	for {
+		select {
+		case <-stop:
+			return
+		case <-session.Done():
+		}
+		select {
+		case <-stop:
+			return
+		default:
+		}
+		if s.Callbacks.OnLost != nil {
+			s.Callbacks.OnLost()
+		}
+
+		delay := minSessionRetryDelay
+		for {
+			if s.shared != nil && !s.waitRenewed(stop) {
+				return
+			}
+			var err error
+			if session, err = s.reregister(); err == nil {
+				break
+			}
+			if s.Callbacks.OnRegisterFailed != nil {
+				s.Callbacks.OnRegisterFailed(err)
+			}
+			select {
+			case <-stop:
+				return
+			case <-s.wake:
+			case <-time.After(delay):
+			}
+			if delay *= 2; delay > maxSessionRetryDelay {
+				delay = maxSessionRetryDelay
+			}
+		}
+	}
+}
+
+// waitRenewed 共享session由SessionManager重建，重建完成前等待通知而不是回调注册失败，
+// stop关闭时返回false
+func (s *Service) waitRenewed(stop chan struct{}) bool {
+	for {
+		select {
+		case <-s.shared.Session().Done():
+		default:
+			return true
+		}
+		select {
+		case <-stop:
+			return false
+		case <-s.wake:
+		}
+	}
+}
+
+// reregister 使用新的session重新注册
+func (s *Service) reregister() (*concurrency.Session, error) {
+	var session *concurrency.Session
+	if s.shared != nil {
+		session = s.shared.Session()
+		select {
+		case <-session.Done():
+			return nil, errors.New("shared session not renewed")
+		default:
+		}
+	} else {
+		var err error
+		if session, err = s.client.NewSession(concurrency.WithTTL(s.ttl)); err != nil {
+			return nil, err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(s.ttl)*time.Second)
+	defer cancel()
+	if err := s.put(ctx, session); err != nil {
+		if s.shared == nil {
+			session.Close()
+		}
+		return nil, err
+	}
+
+	s.mu.Lock()
+	old := s.session
+	s.session = session
+	s.mu.Unlock()
+	if s.shared == nil {
+		// 旧的lease已过期，撤销失败也没有影响
+		old.Close()
+	}
+	if s.Callbacks.OnRegistered != nil {
+		s.Callbacks.OnRegistered()
+	}
+	return session, nil
+}
+
+// UnRegister 停止自动重新注册并删除key
 func (s *Service) UnRegister(ctx context.Context) error {
+	s.stopKeep()
+	s.mu.Lock()
 	client := s.session.Client()
+	s.mu.Unlock()
 	_, err := client.Delete(ctx, s.Key)
 	return err
 }
 
+func (s *Service) stopKeep() {
+	s.mu.Lock()
+	stop, stopped := s.stop, s.stopped
+	s.stop, s.stopped = nil, nil
+	s.mu.Unlock()
+	if stop != nil {
+		close(stop)
+		<-stopped
+	}
+}
+
+// Close 关闭session，共享session时先删除注册的key
 func (s *Service) Close() error {
-	return s.session.Close()
+	if s.shared == nil {
+		s.stopKeep()
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.session.Close()
+	}
+	s.UnRegister(context.Background())
+	return s.shared.Release()
 }
 
 // Discovery
@@ -75,6 +272,9 @@ type Discovery struct {
 	locker   sync.RWMutex
 
 	session *concurrency.Session
+	shared  *SharedSession
+	// renewed 共享session重建后通知Watch
+	renewed chan struct{}
 }
 
 type DiscoveryCallbacks struct {
@@ -83,8 +283,14 @@ type DiscoveryCallbacks struct {
 	OnServiceChanged     func(event DiscoveryEvent, service *Service)
 }
 
+// NewDiscovery 使用默认client创建Discovery
 func NewDiscovery(prefix string, ttl int, cbs DiscoveryCallbacks) (*Discovery, error) {
-	session, err := NewSession(concurrency.WithTTL(ttl))
+	return Default().NewDiscovery(prefix, ttl, cbs)
+}
+
+// NewDiscovery 创建Discovery
+func (c *Client) NewDiscovery(prefix string, ttl int, cbs DiscoveryCallbacks) (*Discovery, error) {
+	session, err := c.NewSession(concurrency.WithTTL(ttl))
 	if err != nil {
 		return nil, err
 	}
@@ -92,8 +298,27 @@ func NewDiscovery(prefix string, ttl int, cbs DiscoveryCallbacks) (*Discovery, e
 	return &Discovery{Prefix: prefix, TTL: ttl, Callbacks: cbs, session: session}, nil
 }
 
+// NewDiscovery 创建使用共享session的Discovery，lease过期时Watch不会退出，session重建后继续监听
+func (m *SessionManager) NewDiscovery(prefix string, ttl int, cbs DiscoveryCallbacks) (*Discovery, error) {
+	renewed := make(chan struct{}, 1)
+	shared, err := m.Acquire(ttl, func(*concurrency.Session) {
+		select {
+		case renewed <- struct{}{}:
+		default:
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	prefix = strings.TrimSuffix(prefix, "/") + "/"
+	return &Discovery{Prefix: prefix, TTL: ttl, Callbacks: cbs, session: shared.Session(), shared: shared, renewed: renewed}, nil
+}
+
 // Watch 监听目录变化
 func (d *Discovery) Watch(ctx context.Context) error {
+	if d.shared != nil {
+		d.session = d.shared.Session()
+	}
 	client := d.session.Client()
 	// get keys with matching prefix
 	rsp, err := client.Get(ctx, d.Prefix, clientv3.WithPrefix())
@@ -114,11 +339,18 @@ func (d *Discovery) Watch(ctx context.Context) error {
 	ch := client.Watch(ctx, d.Prefix, clientv3.WithPrefix())
 	defer d.Callbacks.OnStoppedDiscovering()
 
+	done := d.session.Done()
 	for {
 		select {
-		case <-d.session.Done():
+		case <-done:
 			// closes when the lease is orphaned, expires, or is otherwise no longer being refreshed
-			return nil
+			if d.shared == nil {
+				return nil
+			}
+			// 共享session会自动重建，watch不依赖lease，继续监听
+			done = nil
+		case <-d.renewed:
+			done = d.shared.Session().Done()
 		case rsp, ok := <-ch:
 			// The channel closes when the context is canceled or the underlying watcher
 			// is otherwise disrupted.
@@ -146,6 +378,9 @@ func (d *Discovery) Watch(ctx context.Context) error {
 }
 
 func (d *Discovery) Close() error {
+	if d.shared != nil {
+		return d.shared.Release()
+	}
 	return d.session.Close()
 }
 
@@ -158,7 +393,7 @@ func (d *Discovery) DelServices(ctx context.Context) error {
 
 // GetServices 获取service列表
 func (d *Discovery) GetServices() []*Service {
-	d.locker.RLocker()
+	d.locker.RLock()
 	defer d.locker.RUnlock()
 	services := make([]*Service, 0, len(d.services))
 	for key, val := range d.services {
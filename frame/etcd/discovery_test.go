@@ -0,0 +1,150 @@
+package etcd
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+type discoveryEvent struct {
+	event DiscoveryEvent
+	key   string
+	val   string
+}
+
+func TestDiscovery(t *testing.T) {
+	client := newTestClient(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	started := make(chan struct{}, 1)
+	events := make(chan discoveryEvent, 10)
+	d, err := client.NewDiscovery("/test/services", 5, DiscoveryCallbacks{
+		OnStartedDiscovering: func() { started <- struct{}{} },
+		OnStoppedDiscovering: func() {},
+		OnServiceChanged: func(event DiscoveryEvent, service *Service) {
+			events <- discoveryEvent{event, service.Key, service.Val}
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	go d.Watch(ctx)
+	wait(t, started, "discovery started")
+
+	s1, err := client.NewService("/test/services/1", "10.0.0.1:80", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s1.Close()
+	s2, err := client.NewService("/test/services/2", "10.0.0.2:80", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s2.Close()
+	lost, registered := make(chan struct{}, 1), make(chan struct{}, 2)
+	s2.Callbacks = ServiceCallbacks{
+		OnRegistered: func() { registered <- struct{}{} },
+		OnLost:       func() { lost <- struct{}{} },
+	}
+
+	for _, s := range []*Service{s1, s2} {
+		if err := s.Register(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if ev := wait(t, events, "put"); ev != (discoveryEvent{Put, s.Key, s.Val}) {
+			t.Fatalf("event = %+v", ev)
+		}
+	}
+	wait(t, registered, "OnRegistered")
+	if services := d.GetServices(); len(services) != 2 {
+		t.Fatalf("services = %d, want 2", len(services))
+	}
+
+	if err := s1.UnRegister(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if ev := wait(t, events, "delete"); ev.event != Delete || ev.key != s1.Key {
+		t.Fatalf("event = %+v", ev)
+	}
+
+	// 撤销lease，key被删除后自动重新注册
+	if _, err := client.Revoke(ctx, s2.session.Lease()); err != nil {
+		t.Fatal(err)
+	}
+	if ev := wait(t, events, "revoke"); ev.event != Delete || ev.key != s2.Key {
+		t.Fatalf("event = %+v", ev)
+	}
+	wait(t, lost, "OnLost")
+	wait(t, registered, "OnRegistered")
+	if ev := wait(t, events, "re-register"); ev != (discoveryEvent{Put, s2.Key, s2.Val}) {
+		t.Fatalf("event = %+v", ev)
+	}
+
+	// UnRegister后不再重新注册
+	if err := s2.UnRegister(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if ev := wait(t, events, "unregister"); ev.event != Delete || ev.key != s2.Key {
+		t.Fatalf("event = %+v", ev)
+	}
+
+	// lease过期后key被删除
+	lease, err := client.Grant(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Put(ctx, "/test/services/3", "10.0.0.3:80", clientv3.WithLease(lease.ID)); err != nil {
+		t.Fatal(err)
+	}
+	if ev := wait(t, events, "put"); ev.event != Put || ev.key != "/test/services/3" {
+		t.Fatalf("event = %+v", ev)
+	}
+	if ev := wait(t, events, "lease expiry"); ev.event != Delete || ev.key != "/test/services/3" {
+		t.Fatalf("event = %+v", ev)
+	}
+	if services := d.GetServices(); len(services) != 0 {
+		t.Fatalf("services = %d, want 0", len(services))
+	}
+}
+
+func TestSharedServiceReregister(t *testing.T) {
+	client := newTestClient(t)
+	ctx := context.Background()
+	sm := client.NewSessionManager()
+	defer sm.Close()
+
+	s, err := sm.NewService("/test/shared-services/1", "10.0.0.1:80", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	registered := make(chan struct{}, 2)
+	s.Callbacks.OnRegistered = func() { registered <- struct{}{} }
+	var failed int32
+	s.Callbacks.OnRegisterFailed = func(error) { atomic.AddInt32(&failed, 1) }
+	if err := s.Register(ctx); err != nil {
+		t.Fatal(err)
+	}
+	wait(t, registered, "OnRegistered")
+
+	old := s.session.Lease()
+	if _, err := client.Revoke(ctx, old); err != nil {
+		t.Fatal(err)
+	}
+	wait(t, registered, "re-registered")
+	rsp, err := client.Get(ctx, s.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rsp.Kvs) != 1 || clientv3.LeaseID(rsp.Kvs[0].Lease) == old {
+		t.Fatalf("key not re-registered with new lease: %+v", rsp.Kvs)
+	}
+	// 等待共享session重建不算注册失败
+	if n := atomic.LoadInt32(&failed); n != 0 {
+		t.Fatalf("OnRegisterFailed called %d times, want 0", n)
+	}
+}
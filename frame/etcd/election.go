@@ -12,6 +12,7 @@ package etcd
 
 import (
 	"context"
+	"sync"
 
 	"go.etcd.io/etcd/client/v3/concurrency"
 )
@@ -25,8 +26,19 @@ type Election struct {
 	TTL int
 	// Callbacks are callbacks that are triggered during certain lifecycle events of the LeaderElector
 	Callbacks ElectionCallbacks
-	session   *concurrency.Session
-	election  *concurrency.Election
+
+	// mu 保护以下字段，共享session重建的回调在其他goroutine中执行
+	mu       sync.Mutex
+	session  *concurrency.Session
+	shared   *SharedSession
+	election *concurrency.Election
+	// stopObserve 停止上一次campaign的observe，每个Election只保留一个observe
+	stopObserve context.CancelFunc
+	// ctx 成为leader的Campaign的ctx，lease过期后用它在后台重新参选
+	ctx context.Context
+	// cancel 后台重新参选的ctx，成为leader后继续使用；done 后台参选结束时关闭
+	cancel context.CancelFunc
+	done   chan struct{}
 }
 
 type ElectionCallbacks struct {
@@ -40,8 +52,14 @@ type ElectionCallbacks struct {
 	OnNewLeader func(proposal string)
 }
 
+// NewElection 使用默认client创建选举
 func NewElection(prefix string, proposal string, ttl int, cbs ElectionCallbacks) (*Election, error) {
-	session, err := NewSession(concurrency.WithTTL(ttl))
+	return Default().NewElection(prefix, proposal, ttl, cbs)
+}
+
+// NewElection 创建选举
+func (c *Client) NewElection(prefix string, proposal string, ttl int, cbs ElectionCallbacks) (*Election, error) {
+	session, err := c.NewSession(concurrency.WithTTL(ttl))
 	if err != nil {
 		return nil, err
 	}
@@ -56,11 +74,113 @@ func NewElection(prefix string, proposal string, ttl int, cbs ElectionCallbacks)
 	}, nil
 }
 
+// NewElection 创建使用共享session的选举，同一个SessionManager中相同ttl的prefix不能重复，
+// 否则返回ErrPrefixInUse
+func (m *SessionManager) NewElection(prefix string, proposal string, ttl int, cbs ElectionCallbacks) (*Election, error) {
+	e := &Election{Prefix: prefix, Proposal: proposal, TTL: ttl, Callbacks: cbs}
+	shared, err := m.acquire(ttl, prefix, e.renewed)
+	if err != nil {
+		return nil, err
+	}
+	e.session, e.shared = shared.Session(), shared
+	e.election = concurrency.NewElection(e.session, prefix)
+	return e, nil
+}
+
+// renewed 共享session重建时，旧lease上的leader已经丢失（observe会回调OnStoppedLeading）。
+// 只有Campaign已经成功、ctx未结束时才在后台使用新的session重新参选；
+// 仍在等待的Campaign会返回ErrLockLost，由调用方决定是否重试
+func (e *Election) renewed(*concurrency.Session) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.ctx == nil || e.ctx.Err() != nil || e.done != nil {
+		return
+	}
+	if e.cancel != nil {
+		e.cancel()
+	}
+	ctx, cancel := context.WithCancel(e.ctx)
+	done := make(chan struct{})
+	e.cancel, e.done = cancel, done
+	go func() {
+		defer close(done)
+		// 失败时等待下一次session重建再重试
+		if err := e.campaign(ctx); err != nil {
+			cancel()
+		}
+		e.mu.Lock()
+		if e.done == done {
+			e.done = nil
+		}
+		e.mu.Unlock()
+	}()
+}
+
+// stopRecampaign 停止后台重新参选并等待其退出
+func (e *Election) stopRecampaign() {
+	e.mu.Lock()
+	cancel, done := e.cancel, e.done
+	e.ctx, e.cancel, e.done = nil, nil, nil
+	e.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+	if done != nil {
+		<-done
+	}
+}
+
+// Campaign 阻塞直到成为leader，等待期间session过期时返回ErrLockLost。
+// 使用共享session时，成为leader后lease过期会在session重建后自动重新参选，直到ctx结束、再次Campaign或Close
 func (e *Election) Campaign(ctx context.Context) error {
-	go e.observe(ctx)
+	if e.shared == nil {
+		return e.campaign(ctx)
+	}
+	e.stopRecampaign()
+	if err := e.campaign(ctx); err != nil {
+		return err
+	}
+	e.mu.Lock()
+	e.ctx = ctx
+	e.mu.Unlock()
+	return nil
+}
+
+func (e *Election) campaign(ctx context.Context) error {
+	observeCtx, stopObserve := context.WithCancel(ctx)
+	e.mu.Lock()
+	// 共享session重建后切换到新的session
+	if e.shared != nil {
+		if session := e.shared.Session(); session != e.session {
+			e.session, e.election = session, concurrency.NewElection(session, e.Prefix)
+		}
+	}
+	session, election := e.session, e.election
+	if e.stopObserve != nil {
+		e.stopObserve()
+	}
+	e.stopObserve = stopObserve
+	e.mu.Unlock()
+	go e.observe(observeCtx, session, election)
 
-	err := e.election.Campaign(ctx, e.Proposal)
+	// session过期后旧lease上的key已被删除，停止等待
+	campaignCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-session.Done():
+			cancel()
+		case <-campaignCtx.Done():
+		}
+	}()
+	err := election.Campaign(campaignCtx, e.Proposal)
+	select {
+	case <-session.Done():
+		err = ErrLockLost
+	default:
+	}
 	if err != nil {
+		stopObserve()
 		return err
 	}
 
@@ -68,11 +188,11 @@ func (e *Election) Campaign(ctx context.Context) error {
 	return nil
 }
 
-func (e *Election) observe(ctx context.Context) {
-	ch := e.election.Observe(ctx)
+func (e *Election) observe(ctx context.Context, session *concurrency.Session, election *concurrency.Election) {
+	ch := election.Observe(ctx)
 	for {
 		select {
-		case <-e.session.Done():
+		case <-session.Done():
 			// closes when the lease is orphaned, expires, or is otherwise no longer being refreshed
 			e.Callbacks.OnStoppedLeading()
 			return
@@ -91,6 +211,18 @@ func (e *Election) observe(ctx context.Context) {
 	}
 }
 
+// Close 关闭session，共享session时停止重新参选并放弃leader
 func (e *Election) Close() error {
-	return e.session.Close()
+	if e.shared == nil {
+		return e.session.Close()
+	}
+	e.stopRecampaign()
+	e.mu.Lock()
+	election := e.election
+	if e.stopObserve != nil {
+		e.stopObserve()
+	}
+	e.mu.Unlock()
+	election.Resign(context.Background())
+	return e.shared.Release()
 }
@@ -0,0 +1,109 @@
+package etcd
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type electionEvents struct {
+	started   chan struct{}
+	stopped   chan struct{}
+	newLeader chan string
+}
+
+func newElectionEvents() (*electionEvents, ElectionCallbacks) {
+	ev := &electionEvents{
+		started:   make(chan struct{}, 1),
+		stopped:   make(chan struct{}, 1),
+		newLeader: make(chan string, 10),
+	}
+	return ev, ElectionCallbacks{
+		OnStartedLeading: func(context.Context) { ev.started <- struct{}{} },
+		OnStoppedLeading: func() { ev.stopped <- struct{}{} },
+		OnNewLeader:      func(proposal string) { ev.newLeader <- proposal },
+	}
+}
+
+func wait[T any](t *testing.T, ch <-chan T, what string) T {
+	t.Helper()
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(10 * time.Second):
+		t.Fatalf("timeout waiting for %s", what)
+		panic("unreachable")
+	}
+}
+
+func TestElectionFailover(t *testing.T) {
+	client := newTestClient(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ev1, cbs1 := newElectionEvents()
+	e1, err := client.NewElection("/test/election", "node1", 2, cbs1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e1.Campaign(ctx); err != nil {
+		t.Fatal(err)
+	}
+	wait(t, ev1.started, "node1 leading")
+
+	ev2, cbs2 := newElectionEvents()
+	e2, err := client.NewElection("/test/election", "node2", 2, cbs2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e2.Close()
+	campaigned := make(chan error, 1)
+	go func() { campaigned <- e2.Campaign(ctx) }()
+
+	if leader := wait(t, ev2.newLeader, "node2 observing node1"); leader != "node1" {
+		t.Fatalf("leader = %s, want node1", leader)
+	}
+	select {
+	case <-ev2.started:
+		t.Fatal("node2 leading while node1 is leader")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	// 关闭session撤销lease，node2接替
+	e1.Close()
+	wait(t, ev1.stopped, "node1 stopped")
+	if err := wait(t, campaigned, "node2 campaign"); err != nil {
+		t.Fatal(err)
+	}
+	wait(t, ev2.started, "node2 leading")
+}
+
+func TestCampaign(t *testing.T) {
+	client := newTestClient(t)
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	defer cancel1()
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	defer cancel2()
+
+	ch1, err := client.Campaign(ctx1, "/test/campaign", "node1", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !wait(t, ch1, "node1 campaign") {
+		t.Fatal("node1 not leader")
+	}
+	ch2, err := client.Campaign(ctx2, "/test/campaign", "node2", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-ch2:
+		t.Fatal("node2 leader while node1 is leader")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	cancel1()
+	if !wait(t, ch2, "node2 campaign") {
+		t.Fatal("node2 not leader")
+	}
+}
@@ -0,0 +1,23 @@
+package etcd
+
+import (
+	"testing"
+	"time"
+
+	"frame/etcd/etcdtest"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// newTestClient 启动embedded etcd并创建Client
+func newTestClient(t *testing.T) *Client {
+	client, err := NewClient(&clientv3.Config{
+		Endpoints:   []string{etcdtest.Start(t)},
+		DialTimeout: 5 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
@@ -0,0 +1,44 @@
+// embedded etcd for tests
+/*
+测试使用的进程内etcd，数据放在临时目录，使用随机端口，测试结束时关闭:
+
+	client, err := etcd.NewClient(&clientv3.Config{
+		Endpoints:   []string{etcdtest.Start(t)},
+		DialTimeout: 5 * time.Second,
+	})
+*/
+package etcdtest
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"go.etcd.io/etcd/server/v3/embed"
+)
+
+// readyTimeout 等待etcd启动完成的时间
+const readyTimeout = 10 * time.Second
+
+// Start 在临时目录启动一个进程内的etcd，返回client地址
+func Start(t testing.TB) string {
+	t.Helper()
+	cfg := embed.NewConfig()
+	cfg.Dir = t.TempDir()
+	cfg.LogLevel = "error"
+	local, _ := url.Parse("http://127.0.0.1:0")
+	cfg.LCUrls = []url.URL{*local}
+	cfg.LPUrls = []url.URL{*local}
+
+	e, err := embed.StartEtcd(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(e.Close)
+	select {
+	case <-e.Server.ReadyNotify():
+	case <-time.After(readyTimeout):
+		t.Fatal("embedded etcd not ready")
+	}
+	return e.Clients[0].Addr().String()
+}
@@ -31,19 +31,57 @@ package etcd
 
 import (
 	"context"
+	"sync"
+	"time"
 
+	"frame/lock"
+
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
 	"go.etcd.io/etcd/client/v3/concurrency"
 )
 
+var _ lock.Locker = (*Locker)(nil)
+
+var (
+	ErrLocked   = lock.ErrLocked
+	ErrNotOwner = lock.ErrNotOwner
+	ErrNotFound = lock.ErrNotFound
+	ErrLockLost = lock.ErrLockLost
+)
+
 type Locker struct {
-	Prefix  string
-	TTL     int
-	session *concurrency.Session
-	mutex   *concurrency.Mutex
+	Prefix string
+	TTL    int
+	// Hooks 观测回调，name为Prefix
+	Hooks lock.Hooks
+
+	session  *concurrency.Session
+	shared   *SharedSession
+	mutex    *concurrency.Mutex
+	token    int64
+	acquired time.Time
+
+	// mu 保护holding，共享session重建的回调在其他goroutine中执行
+	mu      sync.Mutex
+	holding *holding
+}
+
+// holding 一次加锁的状态，OnLost只回调一次
+type holding struct {
+	session  *concurrency.Session
+	released chan struct{}
+	lost     sync.Once
 }
 
+// NewLocker 使用默认client创建Locker
 func NewLocker(prefix string, ttl int) (*Locker, error) {
-	session, err := NewSession(concurrency.WithTTL(ttl))
+	return Default().NewLocker(prefix, ttl)
+}
+
+// NewLocker 创建Locker，ttl为session的过期时间（秒）
+func (c *Client) NewLocker(prefix string, ttl int) (*Locker, error) {
+	session, err := c.NewSession(concurrency.WithTTL(ttl))
 	if err != nil {
 		return nil, err
 	}
@@ -51,25 +89,200 @@ func NewLocker(prefix string, ttl int) (*Locker, error) {
 	return &Locker{Prefix: prefix, TTL: ttl, session: session, mutex: mutex}, nil
 }
 
+// NewLocker 创建使用共享session的Locker，同一个SessionManager中相同ttl的prefix不能重复，
+// 否则返回ErrPrefixInUse
+func (m *SessionManager) NewLocker(prefix string, ttl int) (*Locker, error) {
+	l := &Locker{Prefix: prefix, TTL: ttl}
+	shared, err := m.acquire(ttl, prefix, l.renewed)
+	if err != nil {
+		return nil, err
+	}
+	l.session, l.shared = shared.Session(), shared
+	l.mutex = concurrency.NewMutex(l.session, prefix)
+	return l, nil
+}
+
+// renewed 共享session重建时，旧lease上持有的锁已经丢失
+func (l *Locker) renewed(*concurrency.Session) {
+	l.mu.Lock()
+	h := l.holding
+	l.mu.Unlock()
+	if h != nil {
+		l.lost(h)
+	}
+}
+
+// Destory 关闭session，共享session时先释放持有的锁
 func (l *Locker) Destory() error {
-	return l.session.Close()
+	if l.shared == nil {
+		l.stopWatch()
+		return l.session.Close()
+	}
+	l.unlock(context.Background())
+	return l.shared.Release()
+}
+
+// refresh 共享session重建后切换到新的session
+func (l *Locker) refresh() {
+	if l.shared == nil {
+		return
+	}
+	if session := l.shared.Session(); session != l.session {
+		l.session = session
+		l.mutex = concurrency.NewMutex(session, l.Prefix)
+	}
 }
 
+// Trylock Deprecated: 使用 TryLock
 func (l *Locker) Trylock(ctx context.Context) (bool, error) {
+	return l.TryLock(ctx)
+}
+
+func (l *Locker) TryLock(ctx context.Context) (bool, error) {
+	l.refresh()
+	start := time.Now()
 	err := l.mutex.TryLock(ctx)
-	if err == nil {
-		return true, nil
-	}
 	if err == concurrency.ErrLocked {
+		l.Hooks.Contention(l.Prefix)
+		l.Hooks.Acquire(l.Prefix, time.Since(start), ErrLocked)
 		return false, nil
 	}
-	return false, err
+	if err == nil {
+		l.token = l.ownerRevision()
+	}
+	l.acquire(start, err)
+	return err == nil, err
 }
 
 func (l *Locker) Lock(ctx context.Context) error {
-	return l.mutex.Lock(ctx)
+	l.refresh()
+	start := time.Now()
+	err := l.mutex.Lock(ctx)
+	if err == nil {
+		l.token = l.ownerRevision()
+		// 直接拿到锁时Header是创建key的那次写入，Revision等于token；
+		// 排队等待过时Header来自等待结束后的读取，Revision一定更大
+		if l.mutex.Header().Revision != l.token && !l.holds() {
+			l.Hooks.Contention(l.Prefix)
+		}
+	}
+	l.acquire(start, err)
+	return err
+}
+
+// holds 未Unlock时重复加锁
+func (l *Locker) holds() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.holding != nil && l.holding.session == l.session
 }
 
+// acquire 回调加锁结果，成功时开始统计持有时间，并在session过期时回调OnLost
+func (l *Locker) acquire(start time.Time, err error) {
+	l.Hooks.Acquire(l.Prefix, time.Since(start), err)
+	if err != nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.holding != nil {
+		if l.holding.session == l.session {
+			// 未Unlock时重复加锁仍是同一把锁，沿用已有的监听
+			return
+		}
+		close(l.holding.released)
+	}
+	l.acquired = time.Now()
+	h := &holding{session: l.session, released: make(chan struct{})}
+	l.holding = h
+	go l.watch(h)
+}
+
+// watch session过期时回调OnLost
+func (l *Locker) watch(h *holding) {
+	select {
+	case <-h.released:
+	case <-h.session.Done():
+		// Destory主动关闭session前会先关闭released，不算丢锁
+		select {
+		case <-h.released:
+		default:
+			l.lost(h)
+		}
+	}
+}
+
+func (l *Locker) lost(h *holding) {
+	h.lost.Do(func() {
+		l.Hooks.Lost(l.Prefix, ErrLockLost)
+	})
+}
+
+// stopWatch 停止监听session过期
+func (l *Locker) stopWatch() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.holding != nil {
+		close(l.holding.released)
+		l.holding = nil
+	}
+}
+
+// Token 返回当前持有锁的fencing token，即锁key的CreateRevision，
+// 同一个Prefix下后加锁的token一定更大
+func (l *Locker) Token() int64 {
+	return l.token
+}
+
+// ownerRevision 锁key的CreateRevision，取自mutex判断持有者的Compare，不需要额外的请求；
+// 加锁成功后再用调用方的ctx读取key，ctx恰好结束时会返回错误而锁key留在session上
+func (l *Locker) ownerRevision() int64 {
+	cmp := pb.Compare(l.mutex.IsOwner())
+	return cmp.GetCreateRevision()
+}
+
+// Unlock 未加锁时返回ErrNotFound，锁key已随lease过期被删除时返回ErrLockLost
 func (l *Locker) Unlock(ctx context.Context) error {
-	return l.mutex.Unlock(ctx)
+	err := l.unlock(ctx)
+	if err != nil {
+		l.Hooks.UnlockFailed(l.Prefix, err)
+		return err
+	}
+	l.Hooks.Release(l.Prefix, time.Since(l.acquired))
+	return nil
+}
+
+func (l *Locker) unlock(ctx context.Context) error {
+	key := l.mutex.Key()
+	if key == "" || key == "\x00" {
+		return ErrNotFound
+	}
+	rsp, err := l.session.Client().Delete(ctx, key)
+	if err != nil {
+		return err
+	}
+	// 重置mutex状态
+	l.mutex = concurrency.NewMutex(l.session, l.Prefix)
+	l.stopWatch()
+	if rsp.Deleted == 0 {
+		return ErrLockLost
+	}
+	return nil
+}
+
+// Extend 立即为session的lease续约一次，session本身也会自动续约
+func (l *Locker) Extend(ctx context.Context) error {
+	_, err := l.session.Client().KeepAliveOnce(ctx, l.session.Lease())
+	if err == rpctypes.ErrLeaseNotFound {
+		err = ErrLockLost
+	}
+	if err != nil {
+		l.Hooks.RenewFailed(l.Prefix, err)
+	}
+	return err
+}
+
+// Lost session的lease过期或者不再续约时关闭，此时锁已丢失
+func (l *Locker) Lost() <-chan struct{} {
+	return l.session.Done()
 }
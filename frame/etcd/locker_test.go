@@ -0,0 +1,240 @@
+package etcd
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"frame/lock"
+	"frame/lock/locktest"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+func TestLocker(t *testing.T) {
+	client := newTestClient(t)
+
+	locktest.Run(t, func(t *testing.T, key string) lock.Locker {
+		l, err := client.NewLocker(key, 5)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { l.Destory() })
+		return l
+	})
+}
+
+func TestLockerContention(t *testing.T) {
+	client := newTestClient(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var holders, total int32
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		l, err := client.NewLocker("/test/contention", 5)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer l.Destory()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 5; j++ {
+				if err := l.Lock(ctx); err != nil {
+					t.Error(err)
+					return
+				}
+				if atomic.AddInt32(&holders, 1) != 1 {
+					t.Error("lock held by more than one locker")
+				}
+				time.Sleep(time.Millisecond)
+				atomic.AddInt32(&holders, -1)
+				atomic.AddInt32(&total, 1)
+				if err := l.Unlock(ctx); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if total != 25 {
+		t.Fatalf("total = %d, want 25", total)
+	}
+}
+
+func TestLockerLeaseExpiry(t *testing.T) {
+	client := newTestClient(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	l1, err := client.NewLocker("/test/expiry", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lost := make(chan struct{}, 1)
+	l1.Hooks.OnLost = func(name string, err error) { lost <- struct{}{} }
+	if err := l1.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// 停止续约，lease在TTL后过期
+	l1.session.Orphan()
+	select {
+	case <-lost:
+	case <-time.After(5 * time.Second):
+		t.Fatal("OnLost not called")
+	}
+
+	l2, err := client.NewLocker("/test/expiry", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l2.Destory()
+	start := time.Now()
+	if err := l2.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("acquired after lease expiry in %v", time.Since(start))
+
+	if err := l1.Unlock(ctx); err != ErrLockLost {
+		t.Fatalf("Unlock after expiry = %v, want ErrLockLost", err)
+	}
+}
+
+func TestLockerHooks(t *testing.T) {
+	client := newTestClient(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var contention, lost int32
+	hooks := lock.Hooks{
+		OnContention: func(name string) { atomic.AddInt32(&contention, 1) },
+		OnLost:       func(name string, err error) { atomic.AddInt32(&lost, 1) },
+	}
+	l1, err := client.NewLocker("/test/hooks", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l1.Destory()
+	l2, err := client.NewLocker("/test/hooks", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l1.Hooks, l2.Hooks = hooks, hooks
+
+	if err := l1.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&contention); n != 0 {
+		t.Fatalf("contention = %d after uncontended Lock, want 0", n)
+	}
+	// 未Unlock时重复加锁沿用同一把锁
+	if err := l1.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	locked := make(chan error, 1)
+	go func() { locked <- l2.Lock(ctx) }()
+	time.Sleep(200 * time.Millisecond)
+	if err := l1.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-locked; err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&contention); n != 1 {
+		t.Fatalf("contention = %d after waiting Lock, want 1", n)
+	}
+
+	// 主动关闭session不算丢锁
+	if err := l2.Destory(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if n := atomic.LoadInt32(&lost); n != 0 {
+		t.Fatalf("lost = %d after Destory, want 0", n)
+	}
+}
+
+// cancelKV 加锁的Txn返回后立即结束调用方的ctx
+type cancelKV struct {
+	clientv3.KV
+	cancel context.CancelFunc
+}
+
+func (kv *cancelKV) Txn(ctx context.Context) clientv3.Txn {
+	return &cancelTxn{Txn: kv.KV.Txn(ctx), cancel: kv.cancel}
+}
+
+type cancelTxn struct {
+	clientv3.Txn
+	cancel context.CancelFunc
+}
+
+func (t *cancelTxn) If(cs ...clientv3.Cmp) clientv3.Txn {
+	t.Txn = t.Txn.If(cs...)
+	return t
+}
+
+func (t *cancelTxn) Then(ops ...clientv3.Op) clientv3.Txn {
+	t.Txn = t.Txn.Then(ops...)
+	return t
+}
+
+func (t *cancelTxn) Else(ops ...clientv3.Op) clientv3.Txn {
+	t.Txn = t.Txn.Else(ops...)
+	return t
+}
+
+func (t *cancelTxn) Commit() (*clientv3.TxnResponse, error) {
+	rsp, err := t.Txn.Commit()
+	if t.cancel != nil {
+		t.cancel()
+	}
+	return rsp, err
+}
+
+func TestLockerCancelAfterAcquire(t *testing.T) {
+	client := newTestClient(t)
+	kv := &cancelKV{KV: client.KV}
+	client.KV = kv
+
+	l, err := client.NewLocker("/test/cancel", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Destory()
+	for _, lock := range []func(context.Context) error{
+		l.Lock,
+		func(ctx context.Context) error {
+			ok, err := l.TryLock(ctx)
+			if err == nil && !ok {
+				err = ErrLocked
+			}
+			return err
+		},
+	} {
+		// 锁已经拿到后ctx结束，不能返回错误而把锁key留在session上
+		ctx, cancel := context.WithCancel(context.Background())
+		kv.cancel = cancel
+		if err := lock(ctx); err != nil {
+			t.Fatalf("lock with ctx cancelled after acquire = %v", err)
+		}
+		kv.cancel = nil
+		rsp, err := client.Get(context.Background(), l.mutex.Key())
+		if err != nil || len(rsp.Kvs) != 1 {
+			t.Fatalf("Get lock key = %v, %v", rsp, err)
+		}
+		if l.Token() != rsp.Kvs[0].CreateRevision {
+			t.Fatalf("token = %d, want %d", l.Token(), rsp.Kvs[0].CreateRevision)
+		}
+		if err := l.Unlock(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
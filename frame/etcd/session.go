@@ -0,0 +1,248 @@
+// etcd shared session
+/*
+共享 session:
+
+每个 NewLocker、NewElection、NewService、NewDiscovery 都会创建一个 session（lease + keepalive stream），
+使用 SessionManager 创建的组件按 TTL 共享同一个 session:
+
+1、Acquire 对相同 TTL 返回同一个 session 的引用，引用计数，最后一个引用 Release 时撤销 lease
+2、lease 过期（网络分区、keepalive 失败）后，按退避重试重新创建 session，并回调每个引用的 onRenewed：
+  Locker 持有的锁已丢失，回调 Hooks.OnLost，下一次 Lock 时切换到新的 session；
+  Election 停止 leader（OnStoppedLeading），Campaign 的 ctx 未结束时使用新的 session 重新参选；
+  Service 立即使用新的 lease 重新注册；Discovery 继续监听，不会因 lease 过期而退出 Watch
+3、共享 session 不会随组件关闭而撤销，组件 Close 时会先释放自己持有的锁、leader、注册的key
+4、锁和选举的key是 prefix/leaseID，相同 TTL 的 Locker、Election 共用一个 lease，prefix 不能重复，
+  否则 NewLocker、NewElection 返回 ErrPrefixInUse；进程内需要对同一个 prefix 互斥时共用一个 Locker 并配合 sync.Mutex
+
+	sm := client.NewSessionManager()
+	defer sm.Close()
+
+	locker, err := sm.NewLocker("/lock/job", 10)
+	service, err := sm.NewService("/services/app/1", addr, 10)
+*/
+package etcd
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"go.etcd.io/etcd/client/v3/concurrency"
+)
+
+const (
+	minSessionRetryDelay = time.Second
+	maxSessionRetryDelay = 30 * time.Second
+)
+
+// ErrPrefixInUse 同一个共享session中已有相同prefix的Locker或Election
+var ErrPrefixInUse = errors.New("prefix already in use on the shared session")
+
+type SessionManager struct {
+	client *Client
+
+	mu    sync.Mutex
+	pools map[int]*sessionPool
+}
+
+// sessionPool 同一TTL共享的session
+type sessionPool struct {
+	ttl     int
+	session *concurrency.Session
+	refs    map[*SharedSession]struct{}
+	// prefixes Locker、Election使用的prefix，key为prefix/leaseID，不能重复
+	prefixes map[string]struct{}
+	stop     chan struct{}
+}
+
+// SharedSession 共享session的一个引用
+type SharedSession struct {
+	manager   *SessionManager
+	pool      *sessionPool
+	onRenewed func(session *concurrency.Session)
+	prefix    string
+	once      sync.Once
+}
+
+// NewSessionManager 使用默认client创建SessionManager
+func NewSessionManager() *SessionManager {
+	return Default().NewSessionManager()
+}
+
+// NewSessionManager 创建SessionManager
+func (c *Client) NewSessionManager() *SessionManager {
+	return &SessionManager{client: c, pools: make(map[int]*sessionPool)}
+}
+
+// Acquire 获取ttl对应的共享session，lease过期重建后回调onRenewed（可以为nil）
+func (m *SessionManager) Acquire(ttl int, onRenewed func(session *concurrency.Session)) (*SharedSession, error) {
+	return m.acquire(ttl, "", onRenewed)
+}
+
+// acquire prefix不为空时占用prefix，同一个session中prefix重复返回ErrPrefixInUse。
+// 创建session需要Grant和KeepAlive请求，在锁外执行，避免etcd变慢时阻塞整个manager
+func (m *SessionManager) acquire(ttl int, prefix string, onRenewed func(session *concurrency.Session)) (*SharedSession, error) {
+	m.mu.Lock()
+	ref, err := m.join(ttl, prefix, onRenewed)
+	m.mu.Unlock()
+	if ref != nil || err != nil {
+		return ref, err
+	}
+
+	session, err := m.client.NewSession(concurrency.WithTTL(ttl))
+	if err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	// 创建期间其他调用已经创建了pool，使用已有的session
+	if ref, err := m.join(ttl, prefix, onRenewed); ref != nil || err != nil {
+		m.mu.Unlock()
+		session.Close()
+		return ref, err
+	}
+	defer m.mu.Unlock()
+	pool := &sessionPool{
+		ttl:      ttl,
+		session:  session,
+		refs:     make(map[*SharedSession]struct{}),
+		prefixes: make(map[string]struct{}),
+		stop:     make(chan struct{}),
+	}
+	m.pools[ttl] = pool
+	go m.keep(pool)
+	return m.join(ttl, prefix, onRenewed)
+}
+
+// join 加入已有的pool，没有pool时返回nil，需要持有m.mu
+func (m *SessionManager) join(ttl int, prefix string, onRenewed func(session *concurrency.Session)) (*SharedSession, error) {
+	pool, ok := m.pools[ttl]
+	if !ok {
+		return nil, nil
+	}
+	if prefix != "" {
+		if _, used := pool.prefixes[prefix]; used {
+			return nil, ErrPrefixInUse
+		}
+		pool.prefixes[prefix] = struct{}{}
+	}
+	ref := &SharedSession{manager: m, pool: pool, onRenewed: onRenewed, prefix: prefix}
+	pool.refs[ref] = struct{}{}
+	return ref, nil
+}
+
+// keep lease过期后重建session，直到所有引用都已释放
+func (m *SessionManager) keep(pool *sessionPool) {
+	for {
+		m.mu.Lock()
+		session := pool.session
+		m.mu.Unlock()
+
+		select {
+		case <-pool.stop:
+			return
+		case <-session.Done():
+		}
+		select {
+		case <-pool.stop:
+			return
+		default:
+		}
+
+		delay := minSessionRetryDelay
+		for {
+			session, err := m.client.NewSession(concurrency.WithTTL(pool.ttl))
+			if err == nil {
+				if !m.renew(pool, session) {
+					session.Close()
+					return
+				}
+				break
+			}
+			select {
+			case <-pool.stop:
+				return
+			case <-time.After(delay):
+			}
+			if delay *= 2; delay > maxSessionRetryDelay {
+				delay = maxSessionRetryDelay
+			}
+		}
+	}
+}
+
+// renew 替换为新的session并通知所有引用，所有引用都已释放时返回false
+func (m *SessionManager) renew(pool *sessionPool, session *concurrency.Session) bool {
+	m.mu.Lock()
+	select {
+	case <-pool.stop:
+		m.mu.Unlock()
+		return false
+	default:
+	}
+	pool.session = session
+	refs := make([]*SharedSession, 0, len(pool.refs))
+	for ref := range pool.refs {
+		refs = append(refs, ref)
+	}
+	m.mu.Unlock()
+
+	for _, ref := range refs {
+		if ref.onRenewed != nil {
+			ref.onRenewed(session)
+		}
+	}
+	return true
+}
+
+// Close 释放所有共享session
+func (m *SessionManager) Close() error {
+	m.mu.Lock()
+	pools := m.pools
+	m.pools = make(map[int]*sessionPool)
+	m.mu.Unlock()
+
+	var err error
+	for _, pool := range pools {
+		if cerr := m.close(pool); cerr != nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+func (m *SessionManager) close(pool *sessionPool) error {
+	m.mu.Lock()
+	close(pool.stop)
+	session := pool.session
+	m.mu.Unlock()
+	return session.Close()
+}
+
+// Session 当前的session，lease过期且尚未重建时返回已过期的session
+func (s *SharedSession) Session() *concurrency.Session {
+	s.manager.mu.Lock()
+	defer s.manager.mu.Unlock()
+	return s.pool.session
+}
+
+// Release 释放引用，最后一个引用释放时撤销lease
+func (s *SharedSession) Release() error {
+	var err error
+	s.once.Do(func() {
+		m := s.manager
+		m.mu.Lock()
+		delete(s.pool.refs, s)
+		if s.prefix != "" {
+			delete(s.pool.prefixes, s.prefix)
+		}
+		last := len(s.pool.refs) == 0 && m.pools[s.pool.ttl] == s.pool
+		if last {
+			delete(m.pools, s.pool.ttl)
+		}
+		m.mu.Unlock()
+		if last {
+			err = m.close(s.pool)
+		}
+	})
+	return err
+}
@@ -0,0 +1,330 @@
+package etcd
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/concurrency"
+)
+
+func TestSessionManager(t *testing.T) {
+	client := newTestClient(t)
+	sm := client.NewSessionManager()
+	defer sm.Close()
+
+	renewed := make(chan *concurrency.Session, 1)
+	s1, err := sm.Acquire(2, func(session *concurrency.Session) { renewed <- session })
+	if err != nil {
+		t.Fatal(err)
+	}
+	s2, err := sm.Acquire(2, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s1.Session() != s2.Session() {
+		t.Fatal("same ttl should share one session")
+	}
+	old := s1.Session()
+
+	// 撤销lease，模拟过期
+	if _, err := client.Revoke(context.Background(), old.Lease()); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case session := <-renewed:
+		if session == old || s2.Session() != session {
+			t.Fatal("session not renewed")
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("onRenewed not called")
+	}
+
+	// 最后一个引用释放时撤销lease
+	session := s1.Session()
+	s1.Release()
+	select {
+	case <-session.Done():
+		t.Fatal("session closed with remaining refs")
+	default:
+	}
+	s2.Release()
+	select {
+	case <-session.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("session not closed after last release")
+	}
+}
+
+func TestSharedLocker(t *testing.T) {
+	client := newTestClient(t)
+	sm := client.NewSessionManager()
+	defer sm.Close()
+	ctx := context.Background()
+
+	l1, err := sm.NewLocker("/test/shared-a", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l2, err := sm.NewLocker("/test/shared-b", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l1.session.Lease() != l2.session.Lease() {
+		t.Fatal("lockers with same ttl should share one lease")
+	}
+	// 相同prefix在同一个lease上是同一个key，不能重复创建
+	if _, err := sm.NewLocker("/test/shared-a", 5); err != ErrPrefixInUse {
+		t.Fatalf("NewLocker with used prefix = %v, want ErrPrefixInUse", err)
+	}
+	if _, err := sm.NewElection("/test/shared-a", "node", 5, ElectionCallbacks{}); err != ErrPrefixInUse {
+		t.Fatalf("NewElection with used prefix = %v, want ErrPrefixInUse", err)
+	}
+	l3, err := sm.NewLocker("/test/shared-a", 3)
+	if err != nil {
+		t.Fatalf("NewLocker with other ttl: %v", err)
+	}
+	l3.Destory()
+	if err := l1.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := l2.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := client.NewLocker("/test/shared-a", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Destory()
+	if ok, err := other.TryLock(ctx); err != nil || ok {
+		t.Fatalf("TryLock = %v, %v; want false", ok, err)
+	}
+
+	// Destory释放持有的锁，共享session仍然可用
+	if err := l1.Destory(); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := other.TryLock(ctx); err != nil || !ok {
+		t.Fatalf("TryLock = %v, %v; want true", ok, err)
+	}
+	if err := l2.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	l2.Destory()
+
+	// Destory后prefix可以重新使用
+	l4, err := sm.NewLocker("/test/shared-a", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l4.Destory()
+}
+
+func TestSharedSessionRenewed(t *testing.T) {
+	client := newTestClient(t)
+	sm := client.NewSessionManager()
+	defer sm.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var lost int32
+	locker, err := sm.NewLocker("/test/renewed-lock", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer locker.Destory()
+	locker.Hooks.OnLost = func(name string, err error) { atomic.AddInt32(&lost, 1) }
+	if err := locker.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	ev, cbs := newElectionEvents()
+	election, err := sm.NewElection("/test/renewed-election", "node1", 2, cbs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer election.Close()
+	if err := election.Campaign(ctx); err != nil {
+		t.Fatal(err)
+	}
+	wait(t, ev.started, "leading")
+
+	changed := make(chan string, 10)
+	discovery, err := sm.NewDiscovery("/test/renewed-services", 2, DiscoveryCallbacks{
+		OnStartedDiscovering: func() {},
+		OnStoppedDiscovering: func() {},
+		OnServiceChanged:     func(event DiscoveryEvent, service *Service) { changed <- service.Key },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer discovery.Close()
+	watched := make(chan error, 1)
+	go func() { watched <- discovery.Watch(ctx) }()
+
+	// 撤销lease，模拟过期
+	old := locker.session
+	if _, err := client.Revoke(ctx, old.Lease()); err != nil {
+		t.Fatal(err)
+	}
+	wait(t, ev.stopped, "stopped leading")
+	// 重建session后使用新的lease重新参选
+	wait(t, ev.started, "leading again")
+	for deadline := time.Now().Add(5 * time.Second); atomic.LoadInt32(&lost) == 0 && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := locker.Unlock(ctx); err != ErrLockLost {
+		t.Fatalf("Unlock after renewal = %v, want ErrLockLost", err)
+	}
+	if err := locker.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if locker.session == old {
+		t.Fatal("locker not switched to the renewed session")
+	}
+	if err := locker.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// Watch没有因lease过期而退出
+	select {
+	case err := <-watched:
+		t.Fatalf("Watch returned after renewal: %v", err)
+	default:
+	}
+	if _, err := client.Put(ctx, "/test/renewed-services/1", "addr"); err != nil {
+		t.Fatal(err)
+	}
+	if key := wait(t, changed, "service change"); key != "/test/renewed-services/1" {
+		t.Fatalf("changed key = %s", key)
+	}
+	if n := atomic.LoadInt32(&lost); n != 1 {
+		t.Fatalf("lost = %d, want 1", n)
+	}
+}
+
+func TestSharedElectionCampaignLost(t *testing.T) {
+	client := newTestClient(t)
+	sm := client.NewSessionManager()
+	defer sm.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	leaderEv, leaderCbs := newElectionEvents()
+	leader, err := client.NewElection("/test/campaign-lost", "node1", 2, leaderCbs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := leader.Campaign(ctx); err != nil {
+		t.Fatal(err)
+	}
+	wait(t, leaderEv.started, "node1 leading")
+
+	var started int32
+	ev, cbs := newElectionEvents()
+	cbs.OnStartedLeading = func(context.Context) { atomic.AddInt32(&started, 1) }
+	e, err := sm.NewElection("/test/campaign-lost", "node2", 2, cbs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+	campaigned := make(chan error, 1)
+	go func() { campaigned <- e.Campaign(ctx) }()
+	wait(t, ev.newLeader, "node2 observing node1")
+
+	// 等待中lease过期，Campaign返回ErrLockLost
+	old := e.shared.Session()
+	if _, err := client.Revoke(ctx, old.Lease()); err != nil {
+		t.Fatal(err)
+	}
+	if err := wait(t, campaigned, "campaign"); err != ErrLockLost {
+		t.Fatalf("Campaign = %v, want ErrLockLost", err)
+	}
+	for deadline := time.Now().Add(10 * time.Second); e.shared.Session() == old; {
+		if time.Now().After(deadline) {
+			t.Fatal("shared session not renewed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// session重建后不会在后台重新参选，leader退出后也不会成为leader
+	leader.Close()
+	wait(t, leaderEv.stopped, "node1 stopped")
+	time.Sleep(500 * time.Millisecond)
+	if n := atomic.LoadInt32(&started); n != 0 {
+		t.Fatalf("started = %d after lost campaign, want 0", n)
+	}
+
+	// 调用方重试，只有一次Campaign
+	if err := e.Campaign(ctx); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if n := atomic.LoadInt32(&started); n != 1 {
+		t.Fatalf("started = %d after retry, want 1", n)
+	}
+}
+
+// slowLease Grant阻塞直到release关闭
+type slowLease struct {
+	clientv3.Lease
+	release chan struct{}
+}
+
+func (l *slowLease) Grant(ctx context.Context, ttl int64) (*clientv3.LeaseGrantResponse, error) {
+	<-l.release
+	return l.Lease.Grant(ctx, ttl)
+}
+
+func TestSessionManagerSlowGrant(t *testing.T) {
+	client := newTestClient(t)
+	sm := client.NewSessionManager()
+	defer sm.Close()
+
+	s1, err := sm.Acquire(2, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lease := &slowLease{Lease: client.Lease, release: make(chan struct{})}
+	client.Lease = lease
+
+	// 创建新session时不持有manager的锁
+	var wg sync.WaitGroup
+	refs := make([]*SharedSession, 5)
+	for i := range refs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ref, err := sm.Acquire(5, nil)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			refs[i] = ref
+		}(i)
+	}
+	got := make(chan *concurrency.Session, 1)
+	go func() { got <- s1.Session() }()
+	select {
+	case <-got:
+	case <-time.After(time.Second):
+		t.Fatal("Session blocked by a slow Grant")
+	}
+	close(lease.release)
+	wg.Wait()
+
+	// 并发创建时只保留一个session，多余的被关闭
+	for _, ref := range refs[1:] {
+		if ref.Session() != refs[0].Session() {
+			t.Fatal("same ttl should share one session")
+		}
+	}
+	for _, ref := range refs {
+		ref.Release()
+	}
+	s1.Release()
+}
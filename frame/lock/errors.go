@@ -0,0 +1,14 @@
+package lock
+
+import "errors"
+
+var (
+	// ErrLocked 锁被他人持有
+	ErrLocked = errors.New("lock: locked by another owner")
+	// ErrNotOwner 锁存在，但不是当前持有者
+	ErrNotOwner = errors.New("lock: not owner")
+	// ErrNotFound 锁不存在（未加锁或已过期）
+	ErrNotFound = errors.New("lock: not found")
+	// ErrLockLost 持有期间锁丢失（过期、续期失败）
+	ErrLockLost = errors.New("lock: lock lost")
+)
@@ -0,0 +1,57 @@
+package lock
+
+import "time"
+
+// Hooks 锁的观测回调，用于统计等待时间、持有时间、竞争和丢失，未设置的回调不执行。
+// frame/lock.Metrics 提供了导出为 Prometheus 格式的实现
+type Hooks struct {
+	// OnAcquire 一次加锁结束时回调，wait为加锁耗时（含等待），
+	// err为nil表示成功，ErrLocked表示TryLock时锁被他人持有，ctx结束时为ctx.Err()
+	OnAcquire func(name string, wait time.Duration, err error)
+	// OnContention 加锁时发现锁被他人持有，每次加锁最多回调一次
+	OnContention func(name string)
+	// OnRelease 成功释放持有的锁，held为持有时间
+	OnRelease func(name string, held time.Duration)
+	// OnUnlockFailed 释放锁失败（不是持有者、锁已过期、网络错误等）
+	OnUnlockFailed func(name string, err error)
+	// OnRenewFailed 续期失败，包括之后会重试的网络错误
+	OnRenewFailed func(name string, err error)
+	// OnLost 持有期间锁丢失
+	OnLost func(name string, err error)
+}
+
+func (h *Hooks) Acquire(name string, wait time.Duration, err error) {
+	if h.OnAcquire != nil {
+		h.OnAcquire(name, wait, err)
+	}
+}
+
+func (h *Hooks) Contention(name string) {
+	if h.OnContention != nil {
+		h.OnContention(name)
+	}
+}
+
+func (h *Hooks) Release(name string, held time.Duration) {
+	if h.OnRelease != nil {
+		h.OnRelease(name, held)
+	}
+}
+
+func (h *Hooks) UnlockFailed(name string, err error) {
+	if h.OnUnlockFailed != nil {
+		h.OnUnlockFailed(name, err)
+	}
+}
+
+func (h *Hooks) RenewFailed(name string, err error) {
+	if h.OnRenewFailed != nil {
+		h.OnRenewFailed(name, err)
+	}
+}
+
+func (h *Hooks) Lost(name string, err error) {
+	if h.OnLost != nil {
+		h.OnLost(name, err)
+	}
+}
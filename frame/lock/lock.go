@@ -0,0 +1,41 @@
+// distributed lock
+/*
+与后端无关的分布式锁接口，frame/redis 与 frame/etcd 均已实现，切换后端时不需要修改调用代码:
+
+	var l lock.Locker = redisLocker.NewMutex("/lock/job", 10*time.Second)
+	// 或者使用etcd:
+	// el, err := etcd.NewLocker("/lock/job", 10)
+	// if err != nil {
+	// 	return err
+	// }
+	// l = el
+
+	if err := l.Lock(ctx); err != nil {
+		return err
+	}
+	defer l.Unlock(ctx)
+
+	select {
+	case <-l.Lost():
+		// 锁丢失，中止业务
+	case <-doWork():
+	}
+
+新的实现需要通过 frame/lock/locktest 中的一致性测试
+*/
+package lock
+
+import "context"
+
+type Locker interface {
+	// Lock 阻塞加锁直到成功或ctx结束
+	Lock(ctx context.Context) error
+	// TryLock 尝试加锁，锁被他人持有时返回false
+	TryLock(ctx context.Context) (bool, error)
+	// Unlock 释放锁
+	Unlock(ctx context.Context) error
+	// Extend 重置锁的过期时间
+	Extend(ctx context.Context) error
+	// Lost 持有的锁丢失（过期、续期失败等）时关闭，持有者应中止业务
+	Lost() <-chan struct{}
+}
@@ -0,0 +1,182 @@
+// lock conformance tests
+/*
+lock.Locker 的一致性测试，所有实现都需要通过:
+
+	func TestLocker(t *testing.T) {
+		locktest.Run(t, func(t *testing.T, key string) lock.Locker {
+			return locker.NewMutex(key, 10*time.Second)
+		})
+	}
+*/
+package locktest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"frame/lock"
+)
+
+// Factory 每次调用返回一个新的竞争者，相同key的竞争者争抢同一把锁
+type Factory func(t *testing.T, key string) lock.Locker
+
+// Run 执行所有一致性测试
+func Run(t *testing.T, newLocker Factory) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, key string, newLocker Factory)
+	}{
+		{"LockUnlock", testLockUnlock},
+		{"TryLock", testTryLock},
+		{"LockTimeout", testLockTimeout},
+		{"LockWakeup", testLockWakeup},
+		{"ExtendHeld", testExtendHeld},
+		{"Relock", testRelock},
+		{"UnlockNotHeld", testUnlockNotHeld},
+	}
+	for _, tt := range tests {
+		key := fmt.Sprintf("/locktest/%s/%d", tt.name, time.Now().UnixNano())
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, key, newLocker)
+		})
+	}
+}
+
+func timeoutCtx(t *testing.T, d time.Duration) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+func testLockUnlock(t *testing.T, key string, newLocker Factory) {
+	ctx := timeoutCtx(t, 5*time.Second)
+	l := newLocker(t, key)
+	if err := l.Lock(ctx); err != nil {
+		t.Fatalf("Lock: %v", err)
+	}
+	if err := l.Unlock(ctx); err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+}
+
+func testTryLock(t *testing.T, key string, newLocker Factory) {
+	ctx := timeoutCtx(t, 5*time.Second)
+	a, b := newLocker(t, key), newLocker(t, key)
+
+	if ok, err := a.TryLock(ctx); err != nil || !ok {
+		t.Fatalf("a.TryLock = %v, %v; want true, nil", ok, err)
+	}
+	if ok, err := b.TryLock(ctx); err != nil || ok {
+		t.Fatalf("b.TryLock while held = %v, %v; want false, nil", ok, err)
+	}
+	if err := a.Unlock(ctx); err != nil {
+		t.Fatalf("a.Unlock: %v", err)
+	}
+	if ok, err := b.TryLock(ctx); err != nil || !ok {
+		t.Fatalf("b.TryLock after release = %v, %v; want true, nil", ok, err)
+	}
+	if err := b.Unlock(ctx); err != nil {
+		t.Fatalf("b.Unlock: %v", err)
+	}
+}
+
+func testLockTimeout(t *testing.T, key string, newLocker Factory) {
+	ctx := timeoutCtx(t, 5*time.Second)
+	a, b := newLocker(t, key), newLocker(t, key)
+	if err := a.Lock(ctx); err != nil {
+		t.Fatalf("a.Lock: %v", err)
+	}
+	defer a.Unlock(ctx)
+
+	waitCtx, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer cancel()
+	if err := b.Lock(waitCtx); err == nil {
+		t.Fatal("b.Lock while held succeeded")
+	}
+}
+
+func testLockWakeup(t *testing.T, key string, newLocker Factory) {
+	ctx := timeoutCtx(t, 5*time.Second)
+	a, b := newLocker(t, key), newLocker(t, key)
+	if err := a.Lock(ctx); err != nil {
+		t.Fatalf("a.Lock: %v", err)
+	}
+
+	acquired := make(chan error, 1)
+	go func() {
+		acquired <- b.Lock(ctx)
+	}()
+
+	select {
+	case err := <-acquired:
+		t.Fatalf("b.Lock returned %v while a holds the lock", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if err := a.Unlock(ctx); err != nil {
+		t.Fatalf("a.Unlock: %v", err)
+	}
+	select {
+	case err := <-acquired:
+		if err != nil {
+			t.Fatalf("b.Lock: %v", err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("b.Lock not woken up after a.Unlock")
+	}
+	if err := b.Unlock(ctx); err != nil {
+		t.Fatalf("b.Unlock: %v", err)
+	}
+}
+
+func testExtendHeld(t *testing.T, key string, newLocker Factory) {
+	ctx := timeoutCtx(t, 5*time.Second)
+	l := newLocker(t, key)
+	if err := l.Lock(ctx); err != nil {
+		t.Fatalf("Lock: %v", err)
+	}
+	if err := l.Extend(ctx); err != nil {
+		t.Fatalf("Extend: %v", err)
+	}
+	select {
+	case <-l.Lost():
+		t.Fatal("Lost closed while the lock is held")
+	default:
+	}
+	if err := l.Unlock(ctx); err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+}
+
+func testRelock(t *testing.T, key string, newLocker Factory) {
+	ctx := timeoutCtx(t, 5*time.Second)
+	l := newLocker(t, key)
+	for i := 0; i < 3; i++ {
+		if err := l.Lock(ctx); err != nil {
+			t.Fatalf("Lock #%d: %v", i, err)
+		}
+		if err := l.Unlock(ctx); err != nil {
+			t.Fatalf("Unlock #%d: %v", i, err)
+		}
+	}
+}
+
+func testUnlockNotHeld(t *testing.T, key string, newLocker Factory) {
+	ctx := timeoutCtx(t, 5*time.Second)
+	l := newLocker(t, key)
+	if err := l.Unlock(ctx); !errors.Is(err, lock.ErrNotFound) {
+		t.Fatalf("Unlock before Lock = %v; want %v", err, lock.ErrNotFound)
+	}
+	if err := l.Lock(ctx); err != nil {
+		t.Fatalf("Lock: %v", err)
+	}
+	if err := l.Unlock(ctx); err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+	if err := l.Unlock(ctx); !errors.Is(err, lock.ErrNotFound) {
+		t.Fatalf("second Unlock = %v; want %v", err, lock.ErrNotFound)
+	}
+}
@@ -0,0 +1,211 @@
+// lock metrics
+/*
+锁的统计指标，以 Prometheus text format 导出:
+
+	lock_acquire_total{lock,result}      加锁次数，result: ok、locked（TryLock失败）、timeout（ctx结束）、error
+	lock_acquire_wait_seconds{lock}      加锁耗时（histogram）
+	lock_hold_seconds{lock}              持有时间（histogram）
+	lock_contention_total{lock}          加锁时锁被他人持有的次数
+	lock_unlock_failures_total{lock}     释放失败次数
+	lock_renew_failures_total{lock}      续期失败次数
+	lock_lost_total{lock}                持有期间锁丢失次数
+
+	metrics := lock.NewMetrics()
+	// key中带有业务id时，合并为同一个标签，避免时间序列过多
+	metrics.Name = func(key string) string { return strings.SplitN(key, ":", 2)[0] }
+	redisLocker.SetHooks(metrics.Hooks())
+	etcdLocker.Hooks = metrics.Hooks()
+	http.Handle("/metrics/lock", metrics)
+*/
+package lock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Buckets histogram的上界（秒）
+var Buckets = []float64{.001, .005, .01, .05, .1, .5, 1, 5, 10, 30, 60, 300}
+
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func (h *histogram) observe(d time.Duration) {
+	if h.counts == nil {
+		h.counts = make([]uint64, len(Buckets))
+	}
+	v := d.Seconds()
+	for i, le := range Buckets {
+		if v <= le {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += v
+}
+
+type lockMetrics struct {
+	acquire        map[string]uint64
+	wait           histogram
+	hold           histogram
+	contention     uint64
+	unlockFailures uint64
+	renewFailures  uint64
+	lost           uint64
+}
+
+// Metrics 按锁名称汇总的统计指标，实现http.Handler
+type Metrics struct {
+	// Name 将锁的key转换为lock标签，默认使用key本身
+	Name func(key string) string
+
+	mu    sync.Mutex
+	locks map[string]*lockMetrics
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{locks: make(map[string]*lockMetrics)}
+}
+
+// update 在锁内修改key对应的指标
+func (m *Metrics) update(key string, fn func(lm *lockMetrics)) {
+	if m.Name != nil {
+		key = m.Name(key)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	lm, ok := m.locks[key]
+	if !ok {
+		lm = &lockMetrics{acquire: make(map[string]uint64)}
+		m.locks[key] = lm
+	}
+	fn(lm)
+}
+
+// Hooks 返回记录到Metrics的回调
+func (m *Metrics) Hooks() Hooks {
+	return Hooks{
+		OnAcquire: func(name string, wait time.Duration, err error) {
+			m.update(name, func(lm *lockMetrics) {
+				lm.acquire[acquireResult(err)]++
+				lm.wait.observe(wait)
+			})
+		},
+		OnContention: func(name string) {
+			m.update(name, func(lm *lockMetrics) { lm.contention++ })
+		},
+		OnRelease: func(name string, held time.Duration) {
+			m.update(name, func(lm *lockMetrics) { lm.hold.observe(held) })
+		},
+		OnUnlockFailed: func(name string, err error) {
+			m.update(name, func(lm *lockMetrics) { lm.unlockFailures++ })
+		},
+		OnRenewFailed: func(name string, err error) {
+			m.update(name, func(lm *lockMetrics) { lm.renewFailures++ })
+		},
+		OnLost: func(name string, err error) {
+			m.update(name, func(lm *lockMetrics) { lm.lost++ })
+		},
+	}
+}
+
+func acquireResult(err error) string {
+	switch {
+	case err == nil:
+		return "ok"
+	case errors.Is(err, ErrLocked):
+		return "locked"
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	default:
+		return "error"
+	}
+}
+
+// WritePrometheus 以 Prometheus text format 写入所有指标
+func (m *Metrics) WritePrometheus(w io.Writer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	names := make([]string, 0, len(m.locks))
+	for name := range m.locks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	b := &strings.Builder{}
+	header := func(metric, typ, help string) {
+		fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", metric, help, metric, typ)
+	}
+	counter := func(metric, help string, value func(lm *lockMetrics) uint64) {
+		header(metric, "counter", help)
+		for _, name := range names {
+			fmt.Fprintf(b, "%s{lock=\"%s\"} %d\n", metric, escape(name), value(m.locks[name]))
+		}
+	}
+	hist := func(metric, help string, value func(lm *lockMetrics) *histogram) {
+		header(metric, "histogram", help)
+		for _, name := range names {
+			h, label := value(m.locks[name]), escape(name)
+			for i, le := range Buckets {
+				var n uint64
+				if h.counts != nil {
+					n = h.counts[i]
+				}
+				fmt.Fprintf(b, "%s_bucket{lock=\"%s\",le=\"%g\"} %d\n", metric, label, le, n)
+			}
+			fmt.Fprintf(b, "%s_bucket{lock=\"%s\",le=\"+Inf\"} %d\n", metric, label, h.count)
+			fmt.Fprintf(b, "%s_sum{lock=\"%s\"} %g\n", metric, label, h.sum)
+			fmt.Fprintf(b, "%s_count{lock=\"%s\"} %d\n", metric, label, h.count)
+		}
+	}
+
+	header("lock_acquire_total", "counter", "Total number of lock acquisitions by result.")
+	for _, name := range names {
+		lm := m.locks[name]
+		results := make([]string, 0, len(lm.acquire))
+		for result := range lm.acquire {
+			results = append(results, result)
+		}
+		sort.Strings(results)
+		for _, result := range results {
+			fmt.Fprintf(b, "lock_acquire_total{lock=\"%s\",result=\"%s\"} %d\n", escape(name), result, lm.acquire[result])
+		}
+	}
+	hist("lock_acquire_wait_seconds", "Time spent acquiring a lock.",
+		func(lm *lockMetrics) *histogram { return &lm.wait })
+	hist("lock_hold_seconds", "Time a lock was held before release.",
+		func(lm *lockMetrics) *histogram { return &lm.hold })
+	counter("lock_contention_total", "Total number of acquisitions that found the lock held by another owner.",
+		func(lm *lockMetrics) uint64 { return lm.contention })
+	counter("lock_unlock_failures_total", "Total number of failed unlocks.",
+		func(lm *lockMetrics) uint64 { return lm.unlockFailures })
+	counter("lock_renew_failures_total", "Total number of failed lock renewals.",
+		func(lm *lockMetrics) uint64 { return lm.renewFailures })
+	counter("lock_lost_total", "Total number of locks lost while held.",
+		func(lm *lockMetrics) uint64 { return lm.lost })
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// ServeHTTP 导出 Prometheus text format
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WritePrometheus(w)
+}
+
+// escape 转义标签值
+func escape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
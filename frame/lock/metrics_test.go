@@ -0,0 +1,56 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	m := NewMetrics()
+	m.Name = func(key string) string { return strings.SplitN(key, ":", 2)[0] }
+	hooks := m.Hooks()
+
+	hooks.Acquire("order:1", 2*time.Millisecond, nil)
+	hooks.Acquire("order:2", time.Second, ErrLocked)
+	hooks.Acquire("order:3", time.Second, context.DeadlineExceeded)
+	hooks.Contention("order:2")
+	hooks.Release("order:1", 3*time.Second)
+	hooks.UnlockFailed("order:1", ErrNotOwner)
+	hooks.RenewFailed("job", errors.New("i/o timeout"))
+	hooks.Lost("job", ErrLockLost)
+
+	b := &strings.Builder{}
+	if err := m.WritePrometheus(b); err != nil {
+		t.Fatal(err)
+	}
+	out := b.String()
+	for _, want := range []string{
+		`lock_acquire_total{lock="order",result="ok"} 1`,
+		`lock_acquire_total{lock="order",result="locked"} 1`,
+		`lock_acquire_total{lock="order",result="timeout"} 1`,
+		`lock_acquire_wait_seconds_bucket{lock="order",le="0.005"} 1`,
+		`lock_acquire_wait_seconds_bucket{lock="order",le="+Inf"} 3`,
+		`lock_acquire_wait_seconds_count{lock="order"} 3`,
+		`lock_hold_seconds_bucket{lock="order",le="1"} 0`,
+		`lock_hold_seconds_bucket{lock="order",le="5"} 1`,
+		`lock_hold_seconds_sum{lock="order"} 3`,
+		`lock_contention_total{lock="order"} 1`,
+		`lock_unlock_failures_total{lock="order"} 1`,
+		`lock_renew_failures_total{lock="job"} 1`,
+		`lock_lost_total{lock="job"} 1`,
+		`# TYPE lock_hold_seconds histogram`,
+	} {
+		if !strings.Contains(out, want+"\n") {
+			t.Errorf("missing %q in:\n%s", want, out)
+		}
+	}
+}
+
+func TestEscape(t *testing.T) {
+	if got := escape("a\"b\\c\nd"); got != `a\"b\\c\nd` {
+		t.Fatalf("escape = %s", got)
+	}
+}
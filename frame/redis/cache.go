@@ -0,0 +1,173 @@
+// redis cache-aside
+/*
+缓存旁路（cache-aside）:
+
+1、进程内: 相同key的并发加载通过 singleflight 合并为一次
+2、缓存未命中: 对 key:lock 阻塞加锁，只有一个节点执行loader重建缓存，其他节点等锁释放后直接读取重建好的值
+3、缓存过期: 值在 TTL 之后继续保留 StaleTTL，期间直接返回旧值，抢到锁的节点在后台重建
+4、TTL 随机增加 Jitter 比例的时间，避免大量key同时过期（缓存雪崩）
+
+值使用json编码，T需要支持json序列化
+
+	user, err := redis.GetOrLoad(ctx, "user:"+uid, time.Minute, func(ctx context.Context) (*User, error) {
+		return db.GetUser(ctx, uid)
+	})
+*/
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/google/uuid"
+	"golang.org/x/sync/singleflight"
+)
+
+// Cache 缓存配置
+type Cache struct {
+	// StaleTTL 过期后继续保留旧值的时间，默认1m
+	StaleTTL time.Duration
+	// Jitter TTL随机增加的比例，默认0.1
+	Jitter float64
+	// LockTTL 重建锁的过期时间，也是loader的超时时间，默认10s
+	LockTTL time.Duration
+
+	locker *Locker
+	group  singleflight.Group
+}
+
+// NewCache 创建Cache，locker为nil时使用默认Locker
+func NewCache(locker *Locker) *Cache {
+	return &Cache{
+		StaleTTL: time.Minute,
+		Jitter:   0.1,
+		LockTTL:  10 * time.Second,
+		locker:   locker,
+	}
+}
+
+func (c *Cache) getLocker() *Locker {
+	if c.locker == nil {
+		return defaultLocker
+	}
+	return c.locker
+}
+
+// cacheEntry 缓存中保存的值，ExpireAt之后为旧值
+type cacheEntry[T any] struct {
+	Value    T     `json:"v"`
+	ExpireAt int64 `json:"e"`
+}
+
+func (e *cacheEntry[T]) fresh() bool {
+	return time.Now().UnixMilli() < e.ExpireAt
+}
+
+var defaultCache = NewCache(nil)
+
+// GetOrLoad 使用默认Cache读取key，未命中时调用loader加载并缓存ttl时间
+func GetOrLoad[T any](ctx context.Context, key string, ttl time.Duration, loader func(ctx context.Context) (T, error)) (T, error) {
+	return GetOrLoadFrom(ctx, defaultCache, key, ttl, loader)
+}
+
+// GetOrLoadFrom 使用指定Cache读取key，未命中时调用loader加载并缓存ttl时间
+func GetOrLoadFrom[T any](ctx context.Context, c *Cache, key string, ttl time.Duration, loader func(ctx context.Context) (T, error)) (T, error) {
+	var zero T
+	// 相同key使用不同的T时不能合并
+	group := fmt.Sprintf("%T:%s", (*T)(nil), key)
+	ch := c.group.DoChan(group, func() (interface{}, error) {
+		// 合并后的加载不受第一个调用者ctx取消的影响，最长LockTTL
+		ctx, cancel := context.WithTimeout(context.Background(), c.LockTTL)
+		defer cancel()
+		return load(ctx, c, key, ttl, loader)
+	})
+
+	select {
+	case <-ctx.Done():
+		return zero, ctx.Err()
+	case r := <-ch:
+		if r.Err != nil {
+			return zero, r.Err
+		}
+		// T为接口类型且loader返回nil时，r.Val为nil
+		val, _ := r.Val.(T)
+		return val, nil
+	}
+}
+
+func load[T any](ctx context.Context, c *Cache, key string, ttl time.Duration, loader func(ctx context.Context) (T, error)) (T, error) {
+	var zero T
+	locker := c.getLocker()
+	lockKey, token := subKey(key, "lock"), uuid.NewString()
+
+	entry, err := getEntry[T](locker, key)
+	if err != nil {
+		return zero, err
+	}
+	if entry != nil {
+		if entry.fresh() {
+			return entry.Value, nil
+		}
+		// 旧值：抢到锁的节点在后台重建，都先返回旧值
+		if locker.Lock(lockKey, token, c.LockTTL) == nil {
+			go func() {
+				ctx, cancel := context.WithTimeout(context.Background(), c.LockTTL)
+				defer cancel()
+				defer locker.Unlock(lockKey, token)
+				rebuild(ctx, c, key, ttl, loader)
+			}()
+		}
+		return entry.Value, nil
+	}
+
+	// 未命中：只有一个节点重建
+	if err := locker.LockWait(ctx, lockKey, token, c.LockTTL); err != nil {
+		return zero, err
+	}
+	defer locker.Unlock(lockKey, token)
+
+	// 等锁期间其他节点可能已经重建
+	if entry, err = getEntry[T](locker, key); err != nil {
+		return zero, err
+	}
+	if entry != nil && entry.fresh() {
+		return entry.Value, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.LockTTL)
+	defer cancel()
+	return rebuild(ctx, c, key, ttl, loader)
+}
+
+func getEntry[T any](locker *Locker, key string) (*cacheEntry[T], error) {
+	data, err := locker.client.Get(key).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	entry := &cacheEntry[T]{}
+	if err := json.Unmarshal(data, entry); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+func rebuild[T any](ctx context.Context, c *Cache, key string, ttl time.Duration, loader func(ctx context.Context) (T, error)) (T, error) {
+	val, err := loader(ctx)
+	if err != nil {
+		return val, err
+	}
+	if c.Jitter > 0 {
+		ttl += time.Duration(rand.Float64() * c.Jitter * float64(ttl))
+	}
+	data, err := json.Marshal(&cacheEntry[T]{Value: val, ExpireAt: time.Now().Add(ttl).UnixMilli()})
+	if err != nil {
+		return val, err
+	}
+	return val, c.getLocker().client.Set(key, data, ttl+c.StaleTTL).Err()
+}
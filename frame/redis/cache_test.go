@@ -0,0 +1,141 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGetOrLoad(t *testing.T) {
+	l, s := newTestLocker(t)
+	c := NewCache(l)
+	ctx := context.Background()
+
+	var loads int32
+	loader := func(ctx context.Context) (string, error) {
+		n := atomic.AddInt32(&loads, 1)
+		time.Sleep(20 * time.Millisecond)
+		if n > 2 {
+			return "", errors.New("loader called too often")
+		}
+		return "v" + string(rune('0'+n)), nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if v, err := GetOrLoadFrom(ctx, c, "k", time.Minute, loader); err != nil || v != "v1" {
+				t.Errorf("GetOrLoadFrom = %q, %v; want v1", v, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if loads != 1 {
+		t.Fatalf("loader called %d times; want 1", loads)
+	}
+	if ttl := s.TTL("k"); ttl < time.Minute+c.StaleTTL || ttl > time.Minute+c.StaleTTL+6*time.Second {
+		t.Fatalf("ttl = %v; want ttl + jitter + stale ttl", ttl)
+	}
+
+	// 过期后先返回旧值，后台重建
+	expired := `{"v":"v1","e":1}`
+	s.Set("k", expired)
+	if v, err := GetOrLoadFrom(ctx, c, "k", time.Minute, loader); err != nil || v != "v1" {
+		t.Fatalf("GetOrLoadFrom stale = %q, %v; want v1", v, err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for v, _ := s.Get("k"); v == expired && time.Now().Before(deadline); v, _ = s.Get("k") {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if v, err := GetOrLoadFrom(ctx, c, "k", time.Minute, loader); err != nil || v != "v2" {
+		t.Fatalf("GetOrLoadFrom after rebuild = %q, %v; want v2", v, err)
+	}
+}
+
+func TestGetOrLoadError(t *testing.T) {
+	l, s := newTestLocker(t)
+	c := NewCache(l)
+
+	_, err := GetOrLoadFrom(context.Background(), c, "k", time.Minute, func(ctx context.Context) (int, error) {
+		return 0, errors.New("db down")
+	})
+	if err == nil || err.Error() != "db down" {
+		t.Fatalf("GetOrLoadFrom = %v; want loader error", err)
+	}
+	if s.Exists("k") || s.Exists("{k}:lock") {
+		t.Fatal("failed load left keys behind")
+	}
+}
+
+func TestGetOrLoadCallerCancel(t *testing.T) {
+	l, _ := newTestLocker(t)
+	c := NewCache(l)
+
+	started := make(chan struct{})
+	loader := func(ctx context.Context) (string, error) {
+		close(started)
+		time.Sleep(50 * time.Millisecond)
+		return "v", ctx.Err()
+	}
+	ctx1, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		_, err := GetOrLoadFrom(ctx1, c, "k", time.Minute, loader)
+		first <- err
+	}()
+	<-started
+
+	// 第一个调用者取消不影响合并的其他调用者
+	second := make(chan string, 1)
+	go func() {
+		v, err := GetOrLoadFrom(context.Background(), c, "k", time.Minute, loader)
+		if err != nil {
+			t.Errorf("second caller: %v", err)
+		}
+		second <- v
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	if err := <-first; err != context.Canceled {
+		t.Fatalf("first caller = %v; want context.Canceled", err)
+	}
+	if v := <-second; v != "v" {
+		t.Fatalf("second caller = %q; want v", v)
+	}
+}
+
+func TestGetOrLoadTypes(t *testing.T) {
+	l, _ := newTestLocker(t)
+	c := NewCache(l)
+	ctx := context.Background()
+
+	if v, err := GetOrLoadFrom(ctx, c, "nil", time.Minute, func(ctx context.Context) (error, error) {
+		return nil, nil
+	}); err != nil || v != nil {
+		t.Fatalf("interface T with nil value = %v, %v", v, err)
+	}
+
+	// 相同key不同T的并发调用不能共用结果
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		GetOrLoadFrom(ctx, c, "typed", time.Minute, func(ctx context.Context) (int, error) {
+			time.Sleep(20 * time.Millisecond)
+			return 1, nil
+		})
+	}()
+	go func() {
+		defer wg.Done()
+		GetOrLoadFrom(ctx, c, "typed", time.Minute, func(ctx context.Context) (string, error) {
+			time.Sleep(20 * time.Millisecond)
+			return "a", nil
+		})
+	}()
+	wg.Wait()
+}
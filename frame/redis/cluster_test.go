@@ -0,0 +1,48 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis"
+)
+
+func TestSubKey(t *testing.T) {
+	tests := []struct {
+		key, want string
+	}{
+		{"lock", "{lock}:fence"},
+		{"{user1}:lock", "{user1}:lock:fence"},
+		{"a{b}c", "a{b}c:fence"},
+	}
+	for _, tt := range tests {
+		if got := subKey(tt.key, "fence"); got != tt.want {
+			t.Errorf("subKey(%q) = %q; want %q", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestClusterLocker(t *testing.T) {
+	s := miniredis.RunT(t)
+	l := NewClusterLocker(&redis.ClusterOptions{Addrs: []string{s.Addr()}})
+	defer l.Client().Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := l.LockWithToken("k", "a", time.Second); err != nil {
+		t.Fatalf("LockWithToken: %v", err)
+	}
+	if err := l.Unlock("k", "a"); err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+	sem := l.NewSemaphore("s", 1, time.Second)
+	p, err := sem.Acquire(ctx, 1)
+	if err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+	if err := sem.Release(p); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+}
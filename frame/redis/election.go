@@ -0,0 +1,192 @@
+// redis election
+/*
+基于redis的选主，适用于没有etcd的服务，回调与 etcd.ElectionCallbacks 一致:
+
+1、候选者用 Proposal 作为value对 Key 阻塞加锁（LockWait），加锁成功即成为leader，并在 Key:leader 频道publish新leader
+2、leader 通过看门狗（Lease）不断续期，续期失败或Resign时回调 OnStoppedLeading，OnStartedLeading 的ctx同时被取消
+3、所有候选者订阅 Key:leader 频道，并每隔 TTL/3 读取一次 Key（防止错过消息），leader变化时回调 OnNewLeader
+
+	e := locker.NewElection("/election/app", hostname, 10*time.Second, redis.ElectionCallbacks{
+		OnStartedLeading: func(ctx context.Context) { go work(ctx) },
+		OnStoppedLeading: func() {},
+		OnNewLeader:      func(proposal string) {},
+	})
+	if err := e.Campaign(ctx); err != nil {
+		return err
+	}
+	defer e.Resign()
+*/
+package redis
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+type ElectionCallbacks struct {
+	// OnStartedLeading is called when a LeaderElector client starts leading,
+	// the context is canceled when it stops leading
+	OnStartedLeading func(context.Context)
+	// OnStoppedLeading is called when a LeaderElector client stops leading
+	OnStoppedLeading func()
+	// OnNewLeader is called when the client observes a leader that is
+	// not the previously observed leader. This includes the first observed
+	// leader when the client starts.
+	OnNewLeader func(proposal string)
+}
+
+type Election struct {
+	// Key for election
+	Key string
+	// Proposal is the value as eligible for the election on the key
+	Proposal string
+	// TTL is the duration that non-leader candidates will wait to force acquire leadership
+	TTL time.Duration
+	// Callbacks are callbacks that are triggered during certain lifecycle events of the LeaderElector
+	Callbacks ElectionCallbacks
+
+	locker *Locker
+
+	mu     sync.Mutex
+	lease  *Lease
+	cancel context.CancelFunc
+	// stopObserve 停止observe，每个Election只保留一个observe，Resign或下一次Campaign时停止
+	stopObserve context.CancelFunc
+}
+
+// NewElection 创建选举
+func (l *Locker) NewElection(key, proposal string, ttl time.Duration, cbs ElectionCallbacks) *Election {
+	return &Election{
+		Key:       key,
+		Proposal:  proposal,
+		TTL:       ttl,
+		Callbacks: cbs,
+		locker:    l,
+	}
+}
+
+func (e *Election) leaderChannel() string {
+	return e.Key + ":leader"
+}
+
+// Campaign 阻塞直到成为leader或ctx结束，TTL必须大于0
+func (e *Election) Campaign(ctx context.Context) error {
+	lease := e.locker.newLease(e.Key, e.Proposal, e.TTL, WithOnLost(func(error) {
+		e.stopLeading()
+	}))
+	// observe 每隔TTL/3轮询一次leader
+	if err := lease.validate(); err != nil {
+		return err
+	}
+	observeCtx, stopObserve := context.WithCancel(ctx)
+	e.setObserve(stopObserve)
+	go e.observe(observeCtx)
+
+	if err := e.locker.LockWait(ctx, e.Key, e.Proposal, e.TTL); err != nil {
+		e.setObserve(nil)
+		return err
+	}
+	e.locker.client.Publish(e.leaderChannel(), e.Proposal)
+	lease.renewed = time.Now().UnixNano()
+
+	leaderCtx, cancel := context.WithCancel(ctx)
+	e.mu.Lock()
+	e.lease, e.cancel = lease, cancel
+	e.mu.Unlock()
+	go lease.keepAlive()
+
+	if e.Callbacks.OnStartedLeading != nil {
+		e.Callbacks.OnStartedLeading(leaderCtx)
+	}
+	return nil
+}
+
+// setObserve 停止上一个observe，记录新的observe的取消函数
+func (e *Election) setObserve(stop context.CancelFunc) {
+	e.mu.Lock()
+	prev := e.stopObserve
+	e.stopObserve = stop
+	e.mu.Unlock()
+	if prev != nil {
+		prev()
+	}
+}
+
+// Resign 放弃leader并停止observe，其他候选者会立即收到释放通知
+func (e *Election) Resign() error {
+	e.setObserve(nil)
+	e.mu.Lock()
+	lease := e.lease
+	e.mu.Unlock()
+	if lease == nil {
+		return ErrNotFound
+	}
+	err := lease.Unlock()
+	e.stopLeading()
+	return err
+}
+
+// Leader 返回当前的leader，没有leader时返回空字符串
+func (e *Election) Leader() (string, error) {
+	leader, err := e.locker.client.Get(e.Key).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return leader, err
+}
+
+func (e *Election) stopLeading() {
+	e.mu.Lock()
+	cancel := e.cancel
+	e.lease, e.cancel = nil, nil
+	e.mu.Unlock()
+	if cancel == nil {
+		return
+	}
+	cancel()
+	if e.Callbacks.OnStoppedLeading != nil {
+		e.Callbacks.OnStoppedLeading()
+	}
+}
+
+func (e *Election) observe(ctx context.Context) {
+	pubsub := e.locker.client.Subscribe(e.leaderChannel())
+	defer pubsub.Close()
+	ch := pubsub.Channel()
+
+	ticker := time.NewTicker(e.TTL / 3)
+	defer ticker.Stop()
+
+	var last string
+	notify := func(leader string) {
+		if leader == "" || leader == last {
+			return
+		}
+		last = leader
+		if leader != e.Proposal && e.Callbacks.OnNewLeader != nil {
+			e.Callbacks.OnNewLeader(leader)
+		}
+	}
+
+	if leader, err := e.Leader(); err == nil {
+		notify(leader)
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+			notify(msg.Payload)
+		case <-ticker.C:
+			if leader, err := e.Leader(); err == nil {
+				notify(leader)
+			}
+		}
+	}
+}
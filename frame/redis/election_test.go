@@ -0,0 +1,90 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestElection(t *testing.T) {
+	l, _ := newTestLocker(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stopped := make(chan struct{}, 1)
+	var leaderCtx context.Context
+	a := l.NewElection("e", "a", time.Second, ElectionCallbacks{
+		OnStartedLeading: func(ctx context.Context) { leaderCtx = ctx },
+		OnStoppedLeading: func() { stopped <- struct{}{} },
+	})
+	if err := a.Campaign(ctx); err != nil {
+		t.Fatalf("a.Campaign: %v", err)
+	}
+	if leader, err := a.Leader(); err != nil || leader != "a" {
+		t.Fatalf("Leader = %q, %v; want a", leader, err)
+	}
+
+	newLeader := make(chan string, 1)
+	b := l.NewElection("e", "b", time.Second, ElectionCallbacks{
+		OnNewLeader: func(proposal string) { newLeader <- proposal },
+	})
+	elected := make(chan error, 1)
+	go func() {
+		elected <- b.Campaign(ctx)
+	}()
+	select {
+	case leader := <-newLeader:
+		if leader != "a" {
+			t.Fatalf("b observed leader %q; want a", leader)
+		}
+	case <-ctx.Done():
+		t.Fatal("b did not observe the leader")
+	}
+
+	if err := a.Resign(); err != nil {
+		t.Fatalf("a.Resign: %v", err)
+	}
+	<-stopped
+	if leaderCtx.Err() == nil {
+		t.Fatal("OnStartedLeading ctx not canceled after Resign")
+	}
+	if err := <-elected; err != nil {
+		t.Fatalf("b.Campaign: %v", err)
+	}
+	if leader, err := b.Leader(); err != nil || leader != "b" {
+		t.Fatalf("Leader = %q, %v; want b", leader, err)
+	}
+	b.Resign()
+}
+
+func TestElectionSingleObserver(t *testing.T) {
+	l, mr := newTestLocker(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	e := l.NewElection("e", "a", time.Second, ElectionCallbacks{})
+	subscribers := func() int {
+		return mr.PubSubNumSub(e.leaderChannel())[e.leaderChannel()]
+	}
+	waitSubscribers := func(want int) {
+		t.Helper()
+		deadline := time.Now().Add(time.Second)
+		for subscribers() != want && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if n := subscribers(); n != want {
+			t.Fatalf("subscribers = %d; want %d", n, want)
+		}
+	}
+	for i := 0; i < 5; i++ {
+		if err := e.Campaign(ctx); err != nil {
+			t.Fatalf("Campaign: %v", err)
+		}
+		waitSubscribers(1)
+		if err := e.Resign(); err != nil {
+			t.Fatalf("Resign: %v", err)
+		}
+		// Resign后observe退出，不会随Campaign次数累积
+		waitSubscribers(0)
+	}
+}
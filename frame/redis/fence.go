@@ -0,0 +1,74 @@
+// redis fencing token
+/*
+Fencing token:
+https://martin.kleppmann.com/2016/02/08/how-to-do-distributed-locking.html
+
+持有者因为GC停顿、网络延迟等原因，锁过期后仍可能认为自己持有锁。加锁成功时对 key:fence 执行 INCR，
+得到单调递增的 token，写存储时带上 token，存储拒绝比已见过的 token 小的请求，即可拒绝过期的持有者。
+
+注意：key:fence 不设置过期时间，否则计数会重新开始
+*/
+package redis
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// 加锁成功返回递增后的token，否则返回0
+var fenceLockScript = redis.NewScript(`
+	if redis.call("set", KEYS[1], ARGV[1], "nx", "px", ARGV[2])
+	then
+		return redis.call("incr", KEYS[2])
+	end
+	return 0
+`)
+
+// WithFencingToken 加锁时生成fencing token，保存在Lease.Token中
+func WithFencingToken() LeaseOption {
+	return func(ls *Lease) {
+		ls.fencing = true
+	}
+}
+
+// LockWithToken 加锁并返回fencing token
+func (l *Locker) LockWithToken(key, value string, expiration time.Duration) (int64, error) {
+	start := time.Now()
+	token, err := l.lockWithToken(key, value, expiration)
+	l.observe(key, start, err)
+	return token, err
+}
+
+func (l *Locker) lockWithToken(key, value string, expiration time.Duration) (int64, error) {
+	token, err := fenceLockScript.Run(l.client, []string{key, subKey(key, "fence")},
+		value, expiration.Milliseconds()).Int64()
+	if err != nil {
+		return 0, err
+	}
+	if token == 0 {
+		return 0, ErrLocked
+	}
+	l.hold(key, value, expiration)
+	return token, nil
+}
+
+// LockWaitWithToken 阻塞加锁直到成功或ctx结束，并返回fencing token
+func (l *Locker) LockWaitWithToken(ctx context.Context, key, value string, expiration time.Duration) (int64, error) {
+	var token int64
+	err := l.wait(ctx, key, func() (bool, error) {
+		var err error
+		token, err = l.lockWithToken(key, value, expiration)
+		if err == ErrLocked {
+			return false, nil
+		}
+		return err == nil, err
+	})
+	return token, err
+}
+
+// LockWithToken 使用默认Locker加锁并返回fencing token
+func LockWithToken(key, value string, expiration time.Duration) (int64, error) {
+	return defaultLocker.LockWithToken(key, value, expiration)
+}
@@ -0,0 +1,193 @@
+package redis
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"frame/lock"
+)
+
+func TestHooks(t *testing.T) {
+	locker, mr := newTestLocker(t)
+	metrics := lock.NewMetrics()
+	locker.SetHooks(metrics.Hooks())
+	ctx := context.Background()
+
+	m := locker.NewMutex("job", time.Second)
+	if err := m.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := locker.NewMutex("job", time.Second).TryLock(ctx); ok {
+		t.Fatal("TryLock succeeded on held mutex")
+	}
+	ctx2, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if err := locker.LockWait(ctx2, "job", UUID(), time.Second); err != context.DeadlineExceeded {
+		t.Fatalf("LockWait err = %v", err)
+	}
+	if err := m.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Unlock(ctx); err != ErrNotFound {
+		t.Fatalf("second Unlock err = %v", err)
+	}
+
+	lease, err := locker.Obtain("lease", UUID(), 300*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mr.Set("lease", "other")
+	select {
+	case <-lease.Lost():
+	case <-time.After(time.Second):
+		t.Fatal("lease not lost")
+	}
+
+	b := &strings.Builder{}
+	metrics.WritePrometheus(b)
+	out := b.String()
+	for _, want := range []string{
+		`lock_acquire_total{lock="job",result="ok"} 1`,
+		`lock_acquire_total{lock="job",result="locked"} 1`,
+		`lock_acquire_total{lock="job",result="timeout"} 1`,
+		`lock_contention_total{lock="job"} 2`,
+		`lock_hold_seconds_count{lock="job"} 1`,
+		`lock_unlock_failures_total{lock="job"} 1`,
+		`lock_renew_failures_total{lock="lease"} 1`,
+		`lock_lost_total{lock="lease"} 1`,
+	} {
+		if !strings.Contains(out, want+"\n") {
+			t.Errorf("missing %q in:\n%s", want, out)
+		}
+	}
+}
+
+func TestHooksHoldTime(t *testing.T) {
+	locker, _ := newTestLocker(t)
+	metrics := lock.NewMetrics()
+	locker.SetHooks(metrics.Hooks())
+	ctx := context.Background()
+
+	if err := locker.Lock("plain", "v1", time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if err := locker.Unlock("plain", "v1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := locker.LockWait(ctx, "plain", "v2", time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if err := locker.Extend("plain", "v2", time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if err := locker.Unlock("plain", "v2"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := locker.LockWithToken("fenced", "v3", time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if err := locker.Unlock("fenced", "v3"); err != nil {
+		t.Fatal(err)
+	}
+	lease, err := locker.Obtain("lease", UUID(), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := lease.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+
+	b := &strings.Builder{}
+	metrics.WritePrometheus(b)
+	out := b.String()
+	for _, want := range []string{
+		`lock_hold_seconds_count{lock="plain"} 2`,
+		`lock_hold_seconds_count{lock="fenced"} 1`,
+		`lock_hold_seconds_count{lock="lease"} 1`,
+	} {
+		if !strings.Contains(out, want+"\n") {
+			t.Errorf("missing %q in:\n%s", want, out)
+		}
+	}
+}
+
+func TestHooksCoverage(t *testing.T) {
+	locker, _ := newTestLocker(t)
+	metrics := lock.NewMetrics()
+	locker.SetHooks(metrics.Hooks())
+
+	if _, err := locker.LockReentrant("reentrant", "a", time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := locker.LockReentrant("reentrant", "b", time.Second); err != ErrLocked {
+		t.Fatalf("LockReentrant by other owner = %v", err)
+	}
+	if _, err := locker.UnlockReentrant("reentrant", "b"); err != ErrNotOwner {
+		t.Fatalf("UnlockReentrant by other owner = %v", err)
+	}
+	if err := locker.ExtendReentrant("reentrant", "b", time.Second); err != ErrLockLost {
+		t.Fatalf("ExtendReentrant by other owner = %v", err)
+	}
+
+	rw := locker.NewRWLock("rw", time.Second)
+	if ok, err := rw.TryRLock("r1"); !ok || err != nil {
+		t.Fatalf("TryRLock = %v, %v", ok, err)
+	}
+	if ok, err := rw.TryLock("w1"); ok || err != nil {
+		t.Fatalf("TryLock = %v, %v", ok, err)
+	}
+	if err := rw.RUnlock("r2"); err != ErrNotFound {
+		t.Fatalf("RUnlock = %v", err)
+	}
+	if err := rw.Unlock("w1"); err != ErrNotFound {
+		t.Fatalf("Unlock = %v", err)
+	}
+	if err := rw.Extend("w1"); err != ErrLockLost {
+		t.Fatalf("Extend = %v", err)
+	}
+
+	sem := locker.NewSemaphore("sem", 1, time.Second)
+	p, err := sem.TryAcquire(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sem.TryAcquire(1); err != ErrLocked {
+		t.Fatalf("TryAcquire = %v", err)
+	}
+	if err := sem.Release(p); err != nil {
+		t.Fatal(err)
+	}
+	if err := sem.Release(p); err != ErrNotFound {
+		t.Fatalf("second Release = %v", err)
+	}
+	if err := sem.Refresh(p); err != ErrLockLost {
+		t.Fatalf("Refresh = %v", err)
+	}
+
+	b := &strings.Builder{}
+	metrics.WritePrometheus(b)
+	out := b.String()
+	for _, name := range []string{"reentrant", "rw", "sem"} {
+		for _, want := range []string{
+			`lock_acquire_total{lock="` + name + `",result="ok"} 1`,
+			`lock_acquire_total{lock="` + name + `",result="locked"} 1`,
+			`lock_contention_total{lock="` + name + `"} 1`,
+			`lock_renew_failures_total{lock="` + name + `"} 1`,
+		} {
+			if !strings.Contains(out, want+"\n") {
+				t.Errorf("missing %q in:\n%s", want, out)
+			}
+		}
+	}
+	for _, want := range []string{
+		`lock_unlock_failures_total{lock="reentrant"} 1`,
+		`lock_unlock_failures_total{lock="rw"} 2`,
+		`lock_unlock_failures_total{lock="sem"} 1`,
+	} {
+		if !strings.Contains(out, want+"\n") {
+			t.Errorf("missing %q in:\n%s", want, out)
+		}
+	}
+}
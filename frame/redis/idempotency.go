@@ -0,0 +1,148 @@
+// redis idempotency store
+/*
+幂等key存储，用于支付等不能重复执行的接口:
+
+1、Begin: SET NX 将请求key标记为处理中（progress:token），成功则由当前请求执行业务；
+   key已存在时，已完成返回保存的响应，处理中返回 ErrInProgress（如 HTTP 409）
+2、Complete: lua脚本比较token，只有标记的持有者才能保存最终响应（done:response），保存 TTL 时间
+3、Abort: 业务失败且允许重试时，比较token后删除处理中标记
+4、处理中标记在 InProgressTTL 后过期，处理者崩溃后允许客户端重试
+
+	rec, err := store.Begin("pay:" + r.Header.Get("Idempotency-Key"))
+	if err == redis.ErrInProgress {
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+	if rec.Completed() {
+		w.Write(rec.Response)
+		return
+	}
+	rsp, err := pay(r)
+	if err != nil {
+		store.Abort(key, rec.Token)
+		return
+	}
+	store.Complete(key, rec.Token, rsp)
+*/
+package redis
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/google/uuid"
+)
+
+var ErrInProgress = errors.New("request in progress")
+
+const (
+	idempotencyProgress = "progress:"
+	idempotencyDone     = "done:"
+)
+
+// 返回 1: 保存成功, 0: key不存在, -1: token不相等或已完成
+var idempotencyCompleteScript = redis.NewScript(`
+	local value = redis.call("get", KEYS[1])
+	if not value
+	then
+		return 0
+	end
+	if value ~= ARGV[1]
+	then
+		return -1
+	end
+	redis.call("set", KEYS[1], ARGV[2], "px", ARGV[3])
+	return 1
+`)
+
+// 返回 1: 删除成功, 0: key不存在, -1: token不相等或已完成
+var idempotencyAbortScript = redis.NewScript(`
+	local value = redis.call("get", KEYS[1])
+	if not value
+	then
+		return 0
+	end
+	if value ~= ARGV[1]
+	then
+		return -1
+	end
+	redis.call("del", KEYS[1])
+	return 1
+`)
+
+// IdempotencyStore 幂等key存储，不经过Locker的Hooks，幂等key不计入锁的观测指标
+type IdempotencyStore struct {
+	// InProgressTTL 处理中标记的过期时间
+	InProgressTTL time.Duration
+	// TTL 最终响应的保存时间
+	TTL time.Duration
+
+	locker *Locker
+}
+
+// IdempotencyRecord Begin的结果
+type IdempotencyRecord struct {
+	// Token 首次请求时有值，Complete/Abort时使用
+	Token string
+	// Response 请求已完成时保存的响应
+	Response []byte
+}
+
+// Completed 请求是否已完成
+func (r *IdempotencyRecord) Completed() bool {
+	return r.Token == ""
+}
+
+// NewIdempotencyStore 创建幂等key存储
+func (l *Locker) NewIdempotencyStore(inProgressTTL, ttl time.Duration) *IdempotencyStore {
+	return &IdempotencyStore{InProgressTTL: inProgressTTL, TTL: ttl, locker: l}
+}
+
+// Begin 开始处理请求：首次请求返回token，已完成的请求返回保存的响应，处理中的请求返回ErrInProgress
+func (s *IdempotencyStore) Begin(key string) (*IdempotencyRecord, error) {
+	token := uuid.NewString()
+	// 处理中标记恰好过期时重试一次
+	for i := 0; i < 2; i++ {
+		err := s.locker.setNX(key, idempotencyProgress+token, s.InProgressTTL)
+		if err == nil {
+			return &IdempotencyRecord{Token: token}, nil
+		}
+		if err != ErrLocked {
+			return nil, err
+		}
+
+		value, err := s.locker.client.Get(key).Result()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasPrefix(value, idempotencyDone) {
+			return &IdempotencyRecord{Response: []byte(strings.TrimPrefix(value, idempotencyDone))}, nil
+		}
+		return nil, ErrInProgress
+	}
+	return nil, ErrInProgress
+}
+
+// Complete 保存最终响应
+func (s *IdempotencyStore) Complete(key, token string, response []byte) error {
+	ret, err := idempotencyCompleteScript.Run(s.locker.client, []string{key},
+		idempotencyProgress+token, idempotencyDone+string(response), s.TTL.Milliseconds()).Int()
+	if err != nil {
+		return err
+	}
+	return unlockResult(ret)
+}
+
+// Abort 删除处理中标记，允许客户端重试
+func (s *IdempotencyStore) Abort(key, token string) error {
+	ret, err := idempotencyAbortScript.Run(s.locker.client, []string{key}, idempotencyProgress+token).Int()
+	if err != nil {
+		return err
+	}
+	return unlockResult(ret)
+}
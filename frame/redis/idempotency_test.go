@@ -0,0 +1,97 @@
+package redis
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"frame/lock"
+)
+
+func TestIdempotencyStore(t *testing.T) {
+	l, s := newTestLocker(t)
+	store := l.NewIdempotencyStore(time.Second, time.Hour)
+
+	rec, err := store.Begin("pay:1")
+	if err != nil || rec.Completed() {
+		t.Fatalf("Begin = %+v, %v; want token", rec, err)
+	}
+	if _, err := store.Begin("pay:1"); !errors.Is(err, ErrInProgress) {
+		t.Fatalf("duplicate Begin = %v; want %v", err, ErrInProgress)
+	}
+	if err := store.Complete("pay:1", "other", []byte("x")); !errors.Is(err, ErrNotOwner) {
+		t.Fatalf("Complete with wrong token = %v; want %v", err, ErrNotOwner)
+	}
+	if err := store.Complete("pay:1", rec.Token, []byte(`{"ok":true}`)); err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	if ttl := s.TTL("pay:1"); ttl != time.Hour {
+		t.Fatalf("ttl = %v; want %v", ttl, time.Hour)
+	}
+
+	dup, err := store.Begin("pay:1")
+	if err != nil || !dup.Completed() || string(dup.Response) != `{"ok":true}` {
+		t.Fatalf("Begin after Complete = %+v, %v; want cached response", dup, err)
+	}
+	if err := store.Abort("pay:1", rec.Token); !errors.Is(err, ErrNotOwner) {
+		t.Fatalf("Abort after Complete = %v; want %v", err, ErrNotOwner)
+	}
+}
+
+func TestIdempotencyAbort(t *testing.T) {
+	l, s := newTestLocker(t)
+	store := l.NewIdempotencyStore(time.Second, time.Hour)
+
+	rec, err := store.Begin("pay:1")
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	if err := store.Abort("pay:1", rec.Token); err != nil {
+		t.Fatalf("Abort: %v", err)
+	}
+	if rec, err := store.Begin("pay:1"); err != nil || rec.Completed() {
+		t.Fatalf("Begin after Abort = %+v, %v; want token", rec, err)
+	}
+
+	// 处理者崩溃，处理中标记过期后允许重试
+	s.FastForward(2 * time.Second)
+	if rec, err := store.Begin("pay:1"); err != nil || rec.Completed() {
+		t.Fatalf("Begin after in-progress expired = %+v, %v; want token", rec, err)
+	}
+}
+
+func TestIdempotencyNoLockHooks(t *testing.T) {
+	l, _ := newTestLocker(t)
+	metrics := lock.NewMetrics()
+	l.SetHooks(metrics.Hooks())
+	store := l.NewIdempotencyStore(time.Second, time.Minute)
+
+	rec, err := store.Begin("pay:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Begin("pay:1"); err != ErrInProgress {
+		t.Fatalf("duplicate Begin = %v; want ErrInProgress", err)
+	}
+	if err := store.Abort("pay:1", rec.Token); err != nil {
+		t.Fatal(err)
+	}
+	rec, err = store.Begin("pay:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Complete("pay:1", rec.Token, []byte("ok")); err != nil {
+		t.Fatal(err)
+	}
+
+	// 幂等key不计入锁的指标，也不会留在持有时间的记录中
+	b := &strings.Builder{}
+	metrics.WritePrometheus(b)
+	if strings.Contains(b.String(), "pay:1") {
+		t.Fatalf("idempotency key in lock metrics:\n%s", b)
+	}
+	if len(l.held) != 0 {
+		t.Fatalf("held = %v; want empty", l.held)
+	}
+}
@@ -0,0 +1,218 @@
+// redis lock watchdog
+/*
+锁自动续期（看门狗）:
+
+1、Obtain 加锁成功后返回 Lease，后台goroutine每隔 RenewInterval（默认 TTL/3）执行一次续期
+2、续期使用lua脚本 compare-and-extend：只有 value 相等时才重置过期时间，避免延长他人的锁
+3、锁已被删除或被他人持有，或者连续续期失败超过 TTL，认为锁已丢失：关闭 Lost() 并回调 OnLost，持有者应中止业务
+4、Unlock 先停止续期，再删除锁
+
+	lease, err := locker.Obtain("job", redis.UUID(), 10*time.Second)
+	if err != nil {
+		return err
+	}
+	defer lease.Unlock()
+
+	select {
+	case <-lease.Lost():
+		// 锁丢失，中止业务
+	case <-doWork():
+	}
+*/
+package redis
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// extend：value相等时才重置过期时间
+var extendScript = redis.NewScript(`
+	if redis.call("get", KEYS[1]) == ARGV[1]
+	then
+		return redis.call("pexpire", KEYS[1], ARGV[2])
+	else
+		return 0
+	end
+`)
+
+// Extend 只有value相等时才重置过期时间
+func (l *Locker) Extend(key, value string, expiration time.Duration) error {
+	ret, err := extendScript.Run(l.client, []string{key}, value, expiration.Milliseconds()).Int()
+	if err == nil && ret == 0 {
+		err = ErrLockLost
+	}
+	if err != nil {
+		l.hooks.RenewFailed(key, err)
+		return err
+	}
+	l.renewHold(key, value, expiration)
+	return nil
+}
+
+type LeaseOption func(*Lease)
+
+// WithRenewInterval 续期间隔，默认为TTL的1/3
+func WithRenewInterval(interval time.Duration) LeaseOption {
+	return func(ls *Lease) {
+		ls.interval = interval
+	}
+}
+
+// WithOnLost 锁丢失时的回调
+func WithOnLost(fn func(err error)) LeaseOption {
+	return func(ls *Lease) {
+		ls.onLost = fn
+	}
+}
+
+// Lease 已持有的锁，后台自动续期
+type Lease struct {
+	Key   string
+	Value string
+	TTL   time.Duration
+	// Token 递增的fencing token，只有使用WithFencingToken时才有值
+	Token int64
+
+	locker   *Locker
+	interval time.Duration
+	onLost   func(err error)
+	fencing  bool
+	// renewed 最后一次成功加锁/续期的发送时间（UnixNano）
+	renewed int64
+
+	stopOnce sync.Once
+	stop     chan struct{}
+	stopped  chan struct{}
+	lost     chan struct{}
+	err      error
+}
+
+var errInvalidTTL = errors.New("invalid ttl or renew interval")
+
+// Obtain 加锁并启动看门狗自动续期，ttl和续期间隔必须大于0
+func (l *Locker) Obtain(key, value string, ttl time.Duration, opts ...LeaseOption) (*Lease, error) {
+	ls := l.newLease(key, value, ttl, opts...)
+	if err := ls.validate(); err != nil {
+		return nil, err
+	}
+	var err error
+	if ls.fencing {
+		ls.Token, err = l.LockWithToken(key, value, ttl)
+	} else {
+		err = l.Lock(key, value, ttl)
+	}
+	if err != nil {
+		return nil, err
+	}
+	go ls.keepAlive()
+	return ls, nil
+}
+
+func (l *Locker) newLease(key, value string, ttl time.Duration, opts ...LeaseOption) *Lease {
+	ls := &Lease{
+		Key:      key,
+		Value:    value,
+		TTL:      ttl,
+		locker:   l,
+		interval: ttl / 3,
+		renewed:  time.Now().UnixNano(),
+		stop:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+		lost:     make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(ls)
+	}
+	return ls
+}
+
+// validate 续期间隔不大于0时time.NewTicker会panic
+func (ls *Lease) validate() error {
+	if ls.TTL <= 0 || ls.interval <= 0 {
+		return errInvalidTTL
+	}
+	return nil
+}
+
+// Deadline 锁至少持有到该时间：最后一次成功续期的发送时间 + TTL，
+// 之后锁可能已经在服务端过期，即使 Lost() 还没有关闭
+func (ls *Lease) Deadline() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&ls.renewed)).Add(ls.TTL)
+}
+
+// Lost 锁丢失时关闭
+func (ls *Lease) Lost() <-chan struct{} {
+	return ls.lost
+}
+
+// Err 锁丢失的原因，未丢失时返回nil
+func (ls *Lease) Err() error {
+	select {
+	case <-ls.lost:
+		return ls.err
+	default:
+		return nil
+	}
+}
+
+// Unlock 停止续期并释放锁
+func (ls *Lease) Unlock() error {
+	ls.stopOnce.Do(func() {
+		close(ls.stop)
+	})
+	<-ls.stopped
+	if err := ls.Err(); err != nil {
+		return err
+	}
+	return ls.locker.Unlock(ls.Key, ls.Value)
+}
+
+func (ls *Lease) keepAlive() {
+	defer close(ls.stopped)
+
+	ticker := time.NewTicker(ls.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ls.stop:
+			return
+		case <-ticker.C:
+			// 使用发送时间，服务端重置过期时间一定在这之后
+			sent := time.Now()
+			err := ls.locker.Extend(ls.Key, ls.Value, ls.TTL)
+			if err == nil {
+				atomic.StoreInt64(&ls.renewed, sent.UnixNano())
+				continue
+			}
+			// 网络等错误下次重试，超过TTL仍未续期成功则认为锁已丢失
+			if err == ErrLockLost || !time.Now().Before(ls.Deadline()) {
+				ls.setLost(err)
+				return
+			}
+		}
+	}
+}
+
+func (ls *Lease) setLost(err error) {
+	if err != ErrLockLost {
+		err = fmt.Errorf("%w: %v", ErrLockLost, err)
+	}
+	ls.err = err
+	close(ls.lost)
+	ls.locker.hooks.Lost(ls.Key, err)
+	if ls.onLost != nil {
+		ls.onLost(err)
+	}
+}
+
+// Obtain 使用默认Locker加锁并自动续期
+func Obtain(key, value string, ttl time.Duration, opts ...LeaseOption) (*Lease, error) {
+	return defaultLocker.Obtain(key, value, ttl, opts...)
+}
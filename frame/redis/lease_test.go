@@ -0,0 +1,95 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLeaseRenew(t *testing.T) {
+	l, s := newTestLocker(t)
+
+	lease, err := l.Obtain("k", "a", time.Second, WithRenewInterval(10*time.Millisecond))
+	if err != nil {
+		t.Fatalf("Obtain: %v", err)
+	}
+	s.FastForward(900 * time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	if ttl := s.TTL("k"); ttl <= 100*time.Millisecond {
+		t.Fatalf("ttl = %v; lease not renewed", ttl)
+	}
+	if err := lease.Unlock(); err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+	if s.Exists("k") {
+		t.Fatal("key exists after Unlock")
+	}
+}
+
+func TestLeaseLost(t *testing.T) {
+	l, s := newTestLocker(t)
+
+	lostErr := make(chan error, 1)
+	lease, err := l.Obtain("k", "a", time.Second,
+		WithRenewInterval(10*time.Millisecond),
+		WithOnLost(func(err error) { lostErr <- err }),
+	)
+	if err != nil {
+		t.Fatalf("Obtain: %v", err)
+	}
+	s.Set("k", "b")
+
+	select {
+	case <-lease.Lost():
+	case <-time.After(time.Second):
+		t.Fatal("Lost not closed after the lock was taken over")
+	}
+	if err := <-lostErr; !errors.Is(err, ErrLockLost) {
+		t.Fatalf("OnLost err = %v; want %v", err, ErrLockLost)
+	}
+	if err := lease.Unlock(); !errors.Is(err, ErrLockLost) {
+		t.Fatalf("Unlock = %v; want %v", err, ErrLockLost)
+	}
+	if v, _ := s.Get("k"); v != "b" {
+		t.Fatalf("value = %q; lease deleted the new owner's lock", v)
+	}
+}
+
+func TestLeaseFencingToken(t *testing.T) {
+	l, _ := newTestLocker(t)
+
+	first, err := l.Obtain("k", "a", time.Second, WithFencingToken())
+	if err != nil {
+		t.Fatalf("Obtain: %v", err)
+	}
+	first.Unlock()
+	second, err := l.Obtain("k", "a", time.Second, WithFencingToken())
+	if err != nil {
+		t.Fatalf("Obtain: %v", err)
+	}
+	defer second.Unlock()
+	if first.Token == 0 || second.Token <= first.Token {
+		t.Fatalf("tokens %d, %d not increasing", first.Token, second.Token)
+	}
+}
+
+func TestLeaseInvalidTTL(t *testing.T) {
+	l, s := newTestLocker(t)
+
+	if _, err := l.Obtain("k", "a", 0); err != errInvalidTTL {
+		t.Fatalf("Obtain(ttl=0) = %v, want errInvalidTTL", err)
+	}
+	if _, err := l.Obtain("k", "a", time.Second, WithRenewInterval(0)); err != errInvalidTTL {
+		t.Fatalf("Obtain(interval=0) = %v, want errInvalidTTL", err)
+	}
+	if _, err := l.NewMutex("k", 0).TryLock(context.Background()); err != errInvalidTTL {
+		t.Fatalf("Mutex.TryLock(ttl=0) = %v, want errInvalidTTL", err)
+	}
+	if err := l.NewElection("k", "a", 0, ElectionCallbacks{}).Campaign(context.Background()); err != errInvalidTTL {
+		t.Fatalf("Campaign(ttl=0) = %v, want errInvalidTTL", err)
+	}
+	if s.Exists("k") {
+		t.Fatal("key locked with invalid ttl")
+	}
+}
@@ -2,53 +2,296 @@
 package redis
 
 import (
-	"errors"
+	"crypto/tls"
+	"strings"
+	"sync"
 	"time"
 
+	"frame/lock"
+
 	"github.com/go-redis/redis"
 	"github.com/google/uuid"
 )
 
-var client = redis.NewClient(&redis.Options{
-	Addr:     "localhost:6379",
-	Password: "",
-	DB:       0,
-})
+// Options redis连接配置
+type Options struct {
+	// host:port address, 默认 localhost:6379
+	Addr     string
+	Password string
+	DB       int
+	// Maximum number of socket connections, 0 表示使用go-redis默认值
+	PoolSize     int
+	DialTimeout  time.Duration
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	// TLS Config to use. When set TLS will be negotiated.
+	TLSConfig *tls.Config
+}
 
-// lock: value为唯一值（如uuid，orderid等）
-func Lock(key, value string, expiration time.Duration) error {
-	ok, err := client.SetNX(key, value, expiration).Result()
+// NewClient 根据Options创建redis client
+func NewClient(opts *Options) *redis.Client {
+	if opts == nil {
+		opts = &Options{}
+	}
+	addr := opts.Addr
+	if addr == "" {
+		addr = "localhost:6379"
+	}
+	return redis.NewClient(&redis.Options{
+		Addr:         addr,
+		Password:     opts.Password,
+		DB:           opts.DB,
+		PoolSize:     opts.PoolSize,
+		DialTimeout:  opts.DialTimeout,
+		ReadTimeout:  opts.ReadTimeout,
+		WriteTimeout: opts.WriteTimeout,
+		TLSConfig:    opts.TLSConfig,
+	})
+}
+
+// unlock：使用lua脚本保障操作的原子性，删除成功后通知等待者
+// 返回 1: 删除成功, 0: key不存在, -1: value不相等
+var unlockScript = redis.NewScript(`
+	local value = redis.call("get", KEYS[1])
+	if not value
+	then
+		return 0
+	end
+	-- compare value, if equal then del
+	if value ~= ARGV[1]
+	then
+		return -1
+	end
+	redis.call("del", KEYS[1])
+	redis.call("publish", ARGV[2], "")
+	return 1
+`)
+
+var (
+	ErrLocked   = lock.ErrLocked
+	ErrNotOwner = lock.ErrNotOwner
+	ErrNotFound = lock.ErrNotFound
+	ErrLockLost = lock.ErrLockLost
+)
+
+// subKey 派生出的辅助key，与key位于同一个cluster slot，保证多key的lua脚本在cluster下可用。
+// key中没有hash tag时使用{key}作为hash tag，{key}:suffix与key的slot相同
+// （key中包含}但没有hash tag时无法保证，cluster下请使用明确的hash tag，如{order1}:lock）
+func subKey(key, suffix string) string {
+	if hasHashTag(key) {
+		return key + ":" + suffix
+	}
+	return "{" + key + "}:" + suffix
+}
+
+// hasHashTag key中第一个{与其后第一个}之间非空时，cluster只对其中的内容计算slot
+func hasHashTag(key string) bool {
+	start := strings.IndexByte(key, '{')
+	if start < 0 {
+		return false
+	}
+	end := strings.IndexByte(key[start+1:], '}')
+	return end > 0
+}
+
+type Locker struct {
+	client redis.UniversalClient
+	hooks  lock.Hooks
+
+	// held 记录Lock成功的时间，Unlock成功时回调持有时间，只在设置了OnRelease时记录
+	heldMu    sync.Mutex
+	held      map[string]heldLock
+	nextSweep int
+}
+
+type heldLock struct {
+	acquired time.Time
+	expires  time.Time
+}
+
+// NewLocker 根据Options创建Locker
+func NewLocker(opts *Options) *Locker {
+	return NewLockerWithClient(NewClient(opts))
+}
+
+// NewFailoverLocker 使用Sentinel管理的主从创建Locker，主从切换后自动连接新的master
+func NewFailoverLocker(opts *redis.FailoverOptions) *Locker {
+	return NewLockerWithClient(redis.NewFailoverClient(opts))
+}
+
+// NewClusterLocker 使用Cluster创建Locker
+func NewClusterLocker(opts *redis.ClusterOptions) *Locker {
+	return NewLockerWithClient(redis.NewClusterClient(opts))
+}
+
+// NewLockerWithClient 使用已有的client创建Locker，
+// 支持单节点、Sentinel（redis.NewFailoverClient）和Cluster（redis.NewClusterClient）
+func NewLockerWithClient(client redis.UniversalClient) *Locker {
+	return &Locker{client: client}
+}
+
+// Client 获取Locker使用的client
+func (l *Locker) Client() redis.UniversalClient {
+	return l.client
+}
+
+// SetHooks 设置观测回调，需要在使用Locker之前设置，回调的name为锁的key：
+// 加锁结果和竞争：Lock、LockWithToken、LockReentrant、RWLock.TryRLock/TryLock、Semaphore.TryAcquire
+// 以及对应的阻塞版本（LockWait、RLock、Acquire等）；
+// 解锁失败：Unlock、UnlockReentrant、RWLock.RUnlock/Unlock、Semaphore.Release；
+// 续期失败：Extend、ExtendReentrant、RWLock.RExtend/Extend、Semaphore.Refresh；
+// 持有时间只统计 Lock/LockWait/LockWithToken 加的锁（含Lease、Mutex）；丢锁只有 Lease（含Mutex、Election）会回调。
+// IdempotencyStore、TokenBucket、SlidingWindow 不是锁，不会回调
+func (l *Locker) SetHooks(hooks lock.Hooks) {
+	l.hooks = hooks
+}
+
+// observe 回调一次非阻塞加锁的结果
+func (l *Locker) observe(key string, start time.Time, err error) {
+	if err == ErrLocked {
+		l.hooks.Contention(key)
+	}
+	l.hooks.Acquire(key, time.Since(start), err)
+}
+
+// hold 记录加锁时间，过期的记录在记录数翻倍时清理
+func (l *Locker) hold(key, value string, expiration time.Duration) {
+	if l.hooks.OnRelease == nil {
+		return
+	}
+	now := time.Now()
+	l.heldMu.Lock()
+	defer l.heldMu.Unlock()
+	if l.held == nil {
+		l.held = make(map[string]heldLock)
+	}
+	l.held[key+"\x00"+value] = heldLock{acquired: now, expires: expiresAt(now, expiration)}
+	if len(l.held) < l.nextSweep {
+		return
+	}
+	for k, h := range l.held {
+		if !h.expires.IsZero() && now.After(h.expires) {
+			delete(l.held, k)
+		}
+	}
+	l.nextSweep = 2 * len(l.held)
+	if l.nextSweep < minHeldSweep {
+		l.nextSweep = minHeldSweep
+	}
+}
+
+const minHeldSweep = 64
+
+func expiresAt(now time.Time, expiration time.Duration) time.Time {
+	if expiration <= 0 {
+		return time.Time{}
+	}
+	return now.Add(expiration)
+}
+
+// renewHold Extend成功后更新记录的过期时间
+func (l *Locker) renewHold(key, value string, expiration time.Duration) {
+	l.heldMu.Lock()
+	defer l.heldMu.Unlock()
+	k := key + "\x00" + value
+	if h, ok := l.held[k]; ok {
+		h.expires = expiresAt(time.Now(), expiration)
+		l.held[k] = h
+	}
+}
+
+// release Unlock成功后回调持有时间
+func (l *Locker) release(key, value string) {
+	l.heldMu.Lock()
+	k := key + "\x00" + value
+	h, ok := l.held[k]
+	delete(l.held, k)
+	l.heldMu.Unlock()
+	if ok {
+		l.hooks.Release(key, time.Since(h.acquired))
+	}
+}
+
+// lockedErr 把 (ok, err) 形式的加锁结果转换为observe使用的error，未拿到锁时为ErrLocked
+func lockedErr(ok bool, err error) error {
+	if err == nil && !ok {
+		return ErrLocked
+	}
+	return err
+}
+
+// Lock value为唯一值（如uuid，orderid等）
+func (l *Locker) Lock(key, value string, expiration time.Duration) error {
+	start := time.Now()
+	err := l.setNX(key, value, expiration)
+	l.observe(key, start, err)
+	if err == nil {
+		l.hold(key, value, expiration)
+	}
+	return err
+}
+
+func (l *Locker) setNX(key, value string, expiration time.Duration) error {
+	ok, err := l.client.SetNX(key, value, expiration).Result()
 	if err != nil {
 		return err
 	}
 	if !ok {
-		return errors.New("key exist")
+		return ErrLocked
 	}
 	return nil
 }
 
-// unlock：使用lua脚本保障操作的原子性
-func Unlock(key, value string) error {
-	var luaScript = redis.NewScript(`
-		if redis.call("get", KEYS[1]) == ARGV[1]   // compare value, if equal then del
-		then
-			return redis.call("del", KEYS[1])
-		else
-			return -1
-		end
-	`)
-	ret, err := luaScript.Run(client, []string{key}, value).Int()
+// Unlock 只有value相等时才删除key
+func (l *Locker) Unlock(key, value string) error {
+	ret, err := unlockScript.Run(l.client, []string{key}, value, releaseChannel(key)).Int()
+	if err == nil {
+		err = unlockResult(ret)
+	}
 	if err != nil {
+		l.hooks.UnlockFailed(key, err)
 		return err
 	}
+	l.release(key, value)
+	return nil
+}
+
+func unlockResult(ret int) error {
 	if ret < 0 {
-		return errors.New("value not equal")
+		return ErrNotOwner
 	} else if ret == 0 {
-		return errors.New("del fail")
+		return ErrNotFound
 	}
 	return nil
 }
 
+var defaultLocker = NewLocker(nil)
+
+// InitDefaultLocker 初始化默认Locker
+func InitDefaultLocker(opts *Options) {
+	defaultLocker = NewLocker(opts)
+}
+
+// SetDefaultLocker 设置默认Locker
+func SetDefaultLocker(l *Locker) {
+	defaultLocker = l
+}
+
+// GetDefaultLocker 获取默认Locker
+func GetDefaultLocker() *Locker {
+	return defaultLocker
+}
+
+// lock: value为唯一值（如uuid，orderid等）
+func Lock(key, value string, expiration time.Duration) error {
+	return defaultLocker.Lock(key, value, expiration)
+}
+
+// unlock：使用lua脚本保障操作的原子性
+func Unlock(key, value string) error {
+	return defaultLocker.Unlock(key, value)
+}
+
 func UUID() string {
 	return uuid.NewString()
 }
@@ -0,0 +1,150 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// newTestLocker 启动内存中的redis（支持lua脚本），测试结束后自动关闭
+func newTestLocker(t *testing.T) (*Locker, *miniredis.Miniredis) {
+	t.Helper()
+	s := miniredis.RunT(t)
+	l := NewLocker(&Options{Addr: s.Addr()})
+	t.Cleanup(func() { l.Client().Close() })
+	return l, s
+}
+
+func TestLockUnlock(t *testing.T) {
+	l, s := newTestLocker(t)
+
+	if err := l.Lock("k", "a", time.Second); err != nil {
+		t.Fatalf("Lock: %v", err)
+	}
+	if v, _ := s.Get("k"); v != "a" {
+		t.Fatalf("value = %q; want %q", v, "a")
+	}
+	if err := l.Lock("k", "b", time.Second); !errors.Is(err, ErrLocked) {
+		t.Fatalf("Lock while held = %v; want %v", err, ErrLocked)
+	}
+	if err := l.Unlock("k", "b"); !errors.Is(err, ErrNotOwner) {
+		t.Fatalf("Unlock by other owner = %v; want %v", err, ErrNotOwner)
+	}
+	if err := l.Unlock("k", "a"); err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+	if s.Exists("k") {
+		t.Fatal("key exists after Unlock")
+	}
+	if err := l.Unlock("k", "a"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Unlock after release = %v; want %v", err, ErrNotFound)
+	}
+}
+
+func TestLockExpiry(t *testing.T) {
+	l, s := newTestLocker(t)
+
+	if err := l.Lock("k", "a", time.Second); err != nil {
+		t.Fatalf("Lock: %v", err)
+	}
+	s.FastForward(2 * time.Second)
+	if err := l.Lock("k", "b", time.Second); err != nil {
+		t.Fatalf("Lock after expiry: %v", err)
+	}
+	if err := l.Unlock("k", "a"); !errors.Is(err, ErrNotOwner) {
+		t.Fatalf("Unlock by expired owner = %v; want %v", err, ErrNotOwner)
+	}
+}
+
+func TestExtend(t *testing.T) {
+	l, s := newTestLocker(t)
+
+	if err := l.Lock("k", "a", time.Second); err != nil {
+		t.Fatalf("Lock: %v", err)
+	}
+	if err := l.Extend("k", "a", 10*time.Second); err != nil {
+		t.Fatalf("Extend: %v", err)
+	}
+	if ttl := s.TTL("k"); ttl != 10*time.Second {
+		t.Fatalf("ttl = %v; want %v", ttl, 10*time.Second)
+	}
+	if err := l.Extend("k", "b", 10*time.Second); !errors.Is(err, ErrLockLost) {
+		t.Fatalf("Extend by other owner = %v; want %v", err, ErrLockLost)
+	}
+}
+
+func TestLockWaitTimeout(t *testing.T) {
+	l, _ := newTestLocker(t)
+
+	if err := l.Lock("k", "a", time.Minute); err != nil {
+		t.Fatalf("Lock: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := l.LockWait(ctx, "k", "b", time.Minute); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("LockWait = %v; want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestLockWaitContention(t *testing.T) {
+	l, _ := newTestLocker(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var (
+		wg      sync.WaitGroup
+		holders int32
+		total   int32
+	)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			value := UUID()
+			if err := l.LockWait(ctx, "k", value, time.Minute); err != nil {
+				t.Errorf("LockWait: %v", err)
+				return
+			}
+			if n := atomic.AddInt32(&holders, 1); n != 1 {
+				t.Errorf("%d holders at the same time", n)
+			}
+			time.Sleep(5 * time.Millisecond)
+			atomic.AddInt32(&holders, -1)
+			atomic.AddInt32(&total, 1)
+			if err := l.Unlock("k", value); err != nil {
+				t.Errorf("Unlock: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if total != 10 {
+		t.Fatalf("%d of 10 goroutines acquired the lock", total)
+	}
+}
+
+func TestLockWithToken(t *testing.T) {
+	l, _ := newTestLocker(t)
+
+	var last int64
+	for i := 0; i < 3; i++ {
+		token, err := l.LockWithToken("k", "a", time.Second)
+		if err != nil {
+			t.Fatalf("LockWithToken: %v", err)
+		}
+		if token <= last {
+			t.Fatalf("token %d not greater than %d", token, last)
+		}
+		last = token
+		if _, err := l.LockWithToken("k", "b", time.Second); !errors.Is(err, ErrLocked) {
+			t.Fatalf("LockWithToken while held = %v; want %v", err, ErrLocked)
+		}
+		if err := l.Unlock("k", "a"); err != nil {
+			t.Fatalf("Unlock: %v", err)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+// redis mutex
+package redis
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"frame/lock"
+
+	"github.com/google/uuid"
+)
+
+var _ lock.Locker = (*Mutex)(nil)
+
+// Mutex 绑定key的锁，实现lock.Locker，加锁成功后自动续期
+type Mutex struct {
+	Key string
+	TTL time.Duration
+
+	locker *Locker
+	value  string
+
+	mu    sync.Mutex
+	lease *Lease
+}
+
+// NewMutex 创建Mutex，value为随机生成的uuid
+func (l *Locker) NewMutex(key string, ttl time.Duration) *Mutex {
+	return &Mutex{Key: key, TTL: ttl, locker: l, value: uuid.NewString()}
+}
+
+func (m *Mutex) Lock(ctx context.Context) error {
+	lease := m.locker.newLease(m.Key, m.value, m.TTL)
+	if err := lease.validate(); err != nil {
+		return err
+	}
+	if err := m.locker.LockWait(ctx, m.Key, m.value, m.TTL); err != nil {
+		return err
+	}
+	m.hold(lease)
+	return nil
+}
+
+func (m *Mutex) TryLock(ctx context.Context) (bool, error) {
+	lease := m.locker.newLease(m.Key, m.value, m.TTL)
+	if err := lease.validate(); err != nil {
+		return false, err
+	}
+	err := m.locker.Lock(m.Key, m.value, m.TTL)
+	if err == ErrLocked {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	m.hold(lease)
+	return true, nil
+}
+
+func (m *Mutex) hold(lease *Lease) {
+	lease.renewed = time.Now().UnixNano()
+	go lease.keepAlive()
+
+	m.mu.Lock()
+	m.lease = lease
+	m.mu.Unlock()
+}
+
+func (m *Mutex) Unlock(ctx context.Context) error {
+	m.mu.Lock()
+	lease := m.lease
+	m.lease = nil
+	m.mu.Unlock()
+
+	if lease == nil {
+		return m.locker.Unlock(m.Key, m.value)
+	}
+	return lease.Unlock()
+}
+
+func (m *Mutex) Extend(ctx context.Context) error {
+	return m.locker.Extend(m.Key, m.value, m.TTL)
+}
+
+// Lost 未加锁时返回nil
+func (m *Mutex) Lost() <-chan struct{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.lease == nil {
+		return nil
+	}
+	return m.lease.Lost()
+}
@@ -0,0 +1,17 @@
+package redis
+
+import (
+	"testing"
+	"time"
+
+	"frame/lock"
+	"frame/lock/locktest"
+)
+
+func TestMutex(t *testing.T) {
+	locker, _ := newTestLocker(t)
+
+	locktest.Run(t, func(t *testing.T, key string) lock.Locker {
+		return locker.NewMutex(key, 2*time.Second)
+	})
+}
@@ -0,0 +1,231 @@
+// redis delayed queue
+/*
+延迟队列，至少一次（at-least-once）投递:
+
+1、Enqueue: 任务内容保存在 hash name:jobs，任务id按执行时间保存在 zset name:delayed
+2、Dequeue: lua脚本原子地取出一个到期的任务，移到 zset name:processing，score 为可见性超时的截止时间，并增加尝试次数
+3、Ack: 处理成功后删除任务；Nack: 处理失败后延迟重新入队
+4、Reap: worker 崩溃或处理超时（截止时间前未Ack）的任务被重新放回 name:delayed，因此 handler 需要幂等
+
+	q := redis.NewQueue(locker.Client(), "email", time.Minute)
+	q.EnqueueIn(payload, 10*time.Second)
+
+	go q.RunReaper(ctx, 10*time.Second)
+	q.Work(ctx, func(ctx context.Context, job *redis.Job) error {
+		return send(job.Payload)
+	})
+*/
+package redis
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/google/uuid"
+)
+
+var ErrJobNotFound = errors.New("job not found")
+
+// KEYS: delayed, jobs; ARGV: id, payload, run at
+var enqueueScript = redis.NewScript(`
+	redis.call("hset", KEYS[2], ARGV[1], ARGV[2])
+	redis.call("zadd", KEYS[1], ARGV[3], ARGV[1])
+	return 1
+`)
+
+// KEYS: delayed, jobs, processing, attempts; ARGV: visibility timeout
+var dequeueScript = redis.NewScript(luaNow + `
+	local ids = redis.call("zrangebyscore", KEYS[1], "-inf", now, "limit", 0, 1)
+	if #ids == 0
+	then
+		return false
+	end
+	local id = ids[1]
+	redis.call("zrem", KEYS[1], id)
+	redis.call("zadd", KEYS[3], now + tonumber(ARGV[1]), id)
+	local attempts = redis.call("hincrby", KEYS[4], id, 1)
+	return {id, redis.call("hget", KEYS[2], id), attempts}
+`)
+
+// KEYS: processing, jobs, attempts; ARGV: id
+var ackScript = redis.NewScript(`
+	if redis.call("zrem", KEYS[1], ARGV[1]) == 0
+	then
+		return 0
+	end
+	redis.call("hdel", KEYS[2], ARGV[1])
+	redis.call("hdel", KEYS[3], ARGV[1])
+	return 1
+`)
+
+// KEYS: processing, delayed; ARGV: id, delay
+var nackScript = redis.NewScript(luaNow + `
+	if redis.call("zrem", KEYS[1], ARGV[1]) == 0
+	then
+		return 0
+	end
+	redis.call("zadd", KEYS[2], now + tonumber(ARGV[2]), ARGV[1])
+	return 1
+`)
+
+// KEYS: processing, delayed
+var reapScript = redis.NewScript(luaNow + `
+	local ids = redis.call("zrangebyscore", KEYS[1], "-inf", now)
+	for _, id in ipairs(ids) do
+		redis.call("zrem", KEYS[1], id)
+		redis.call("zadd", KEYS[2], now, id)
+	end
+	return #ids
+`)
+
+// Job 队列中的任务
+type Job struct {
+	ID      string
+	Payload string
+	// Attempts 第几次投递
+	Attempts int64
+}
+
+// Queue 延迟队列
+type Queue struct {
+	Name string
+	// VisibilityTimeout 出队后在该时间内未Ack的任务会被Reap重新入队
+	VisibilityTimeout time.Duration
+	// PollInterval Work没有到期任务时的轮询间隔，默认1s
+	PollInterval time.Duration
+	// RetryDelay handler失败后重新入队的延迟，按尝试次数线性增加，默认1s
+	RetryDelay time.Duration
+
+	client redis.UniversalClient
+}
+
+// NewQueue 创建队列，与Locker共用client时使用 locker.Client()
+func NewQueue(client redis.UniversalClient, name string, visibilityTimeout time.Duration) *Queue {
+	return &Queue{
+		Name:              name,
+		VisibilityTimeout: visibilityTimeout,
+		PollInterval:      time.Second,
+		RetryDelay:        time.Second,
+		client:            client,
+	}
+}
+
+func (q *Queue) delayedKey() string    { return subKey(q.Name, "delayed") }
+func (q *Queue) jobsKey() string       { return subKey(q.Name, "jobs") }
+func (q *Queue) processingKey() string { return subKey(q.Name, "processing") }
+func (q *Queue) attemptsKey() string   { return subKey(q.Name, "attempts") }
+
+// Enqueue 添加任务，runAt之后可以被Dequeue，返回任务id
+func (q *Queue) Enqueue(payload string, runAt time.Time) (string, error) {
+	id := uuid.NewString()
+	err := enqueueScript.Run(q.client, []string{q.delayedKey(), q.jobsKey()},
+		id, payload, runAt.UnixMilli()).Err()
+	if err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// EnqueueIn 添加任务，delay之后可以被Dequeue
+func (q *Queue) EnqueueIn(payload string, delay time.Duration) (string, error) {
+	return q.Enqueue(payload, time.Now().Add(delay))
+}
+
+// Dequeue 取出一个到期的任务，没有到期任务时返回nil
+func (q *Queue) Dequeue() (*Job, error) {
+	keys := []string{q.delayedKey(), q.jobsKey(), q.processingKey(), q.attemptsKey()}
+	rsp, err := dequeueScript.Run(q.client, keys, q.VisibilityTimeout.Milliseconds()).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	vals, ok := rsp.([]interface{})
+	if !ok || len(vals) != 3 {
+		return nil, errors.New("unexpected dequeue result")
+	}
+	job := &Job{}
+	job.ID, _ = vals[0].(string)
+	job.Payload, _ = vals[1].(string)
+	job.Attempts, _ = vals[2].(int64)
+	return job, nil
+}
+
+// Ack 任务处理成功，删除任务
+func (q *Queue) Ack(job *Job) error {
+	keys := []string{q.processingKey(), q.jobsKey(), q.attemptsKey()}
+	ok, err := ackScript.Run(q.client, keys, job.ID).Bool()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		// 已超时被重新入队
+		return ErrJobNotFound
+	}
+	return nil
+}
+
+// Nack 任务处理失败，delay之后重新投递
+func (q *Queue) Nack(job *Job, delay time.Duration) error {
+	keys := []string{q.processingKey(), q.delayedKey()}
+	ok, err := nackScript.Run(q.client, keys, job.ID, delay.Milliseconds()).Bool()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrJobNotFound
+	}
+	return nil
+}
+
+// Reap 将处理超时的任务重新入队，返回重新入队的任务数
+func (q *Queue) Reap() (int, error) {
+	return reapScript.Run(q.client, []string{q.processingKey(), q.delayedKey()}).Int()
+}
+
+// RunReaper 每隔interval执行一次Reap，直到ctx结束
+func (q *Queue) RunReaper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			q.Reap()
+		}
+	}
+}
+
+// Work 循环处理任务直到ctx结束，handler返回nil时Ack，否则Nack
+func (q *Queue) Work(ctx context.Context, handler func(ctx context.Context, job *Job) error) error {
+	for {
+		job, err := q.Dequeue()
+		if err != nil {
+			return err
+		}
+		if job == nil {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(q.PollInterval):
+				continue
+			}
+		}
+
+		if err = handler(ctx, job); err != nil {
+			err = q.Nack(job, time.Duration(job.Attempts)*q.RetryDelay)
+		} else {
+			err = q.Ack(job)
+		}
+		if err != nil && err != ErrJobNotFound {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestQueue(t *testing.T) {
+	l, s := newTestLocker(t)
+	now := time.Now()
+	s.SetTime(now)
+	q := NewQueue(l.Client(), "q", time.Minute)
+
+	id, err := q.Enqueue("hello", now.Add(time.Second))
+	if err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	if job, err := q.Dequeue(); err != nil || job != nil {
+		t.Fatalf("Dequeue before run at = %+v, %v; want nil, nil", job, err)
+	}
+
+	s.SetTime(now.Add(time.Second))
+	job, err := q.Dequeue()
+	if err != nil || job == nil {
+		t.Fatalf("Dequeue = %+v, %v; want job", job, err)
+	}
+	if job.ID != id || job.Payload != "hello" || job.Attempts != 1 {
+		t.Fatalf("job = %+v", job)
+	}
+
+	// worker崩溃，可见性超时后重新投递
+	if n, err := q.Reap(); err != nil || n != 0 {
+		t.Fatalf("Reap before timeout = %d, %v; want 0, nil", n, err)
+	}
+	s.SetTime(now.Add(2 * time.Minute))
+	if n, err := q.Reap(); err != nil || n != 1 {
+		t.Fatalf("Reap = %d, %v; want 1, nil", n, err)
+	}
+	if err := q.Ack(job); !errors.Is(err, ErrJobNotFound) {
+		t.Fatalf("Ack of reaped job = %v; want %v", err, ErrJobNotFound)
+	}
+	job, err = q.Dequeue()
+	if err != nil || job == nil || job.Attempts != 2 {
+		t.Fatalf("Dequeue after reap = %+v, %v; want second attempt", job, err)
+	}
+	if err := q.Ack(job); err != nil {
+		t.Fatalf("Ack: %v", err)
+	}
+	if job, err := q.Dequeue(); err != nil || job != nil {
+		t.Fatalf("Dequeue after ack = %+v, %v; want nil, nil", job, err)
+	}
+}
+
+func TestQueueWork(t *testing.T) {
+	l, _ := newTestLocker(t)
+	q := NewQueue(l.Client(), "q", time.Minute)
+	q.PollInterval = 10 * time.Millisecond
+	q.RetryDelay = 0
+
+	if _, err := q.EnqueueIn("job", 0); err != nil {
+		t.Fatalf("EnqueueIn: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var attempts []int64
+	err := q.Work(ctx, func(ctx context.Context, job *Job) error {
+		attempts = append(attempts, job.Attempts)
+		if job.Attempts == 1 {
+			return errors.New("fail once")
+		}
+		cancel()
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Work = %v; want %v", err, context.Canceled)
+	}
+	if len(attempts) != 2 || attempts[1] != 2 {
+		t.Fatalf("attempts = %v; want [1 2]", attempts)
+	}
+}
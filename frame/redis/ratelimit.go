@@ -0,0 +1,183 @@
+// redis rate limiter
+/*
+分布式限流，所有节点共享同一个计数，按key（用户、IP、租户等）分别限流:
+
+1、令牌桶 TokenBucket: hash 保存剩余令牌数和上次更新时间，每次请求先按流逝时间补充令牌（不超过Burst），
+   令牌足够时扣减；允许一定的突发流量
+2、滑动窗口日志 SlidingWindow: zset 保存窗口内每个请求的时间，先删除窗口外的记录，
+   窗口内请求数未超过Limit时记录本次请求；限流精确，但每个请求占用一个member
+
+两种算法都在lua脚本中原子执行，时间使用redis服务器时间，返回是否允许、剩余配额以及多久之后可以重试
+
+	limiter := redis.NewTokenBucket(locker.Client(), 10, 20)
+	rsp, err := limiter.Allow("ratelimit:user:" + uid)
+	if err == nil && !rsp.Allowed {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(rsp.RetryAfter.Seconds()))))
+		w.WriteHeader(http.StatusTooManyRequests)
+	}
+*/
+package redis
+
+import (
+	"errors"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/google/uuid"
+)
+
+// RateLimitResult 限流结果
+type RateLimitResult struct {
+	// Allowed 是否允许本次请求
+	Allowed bool
+	// Remaining 剩余配额
+	Remaining int64
+	// RetryAfter 不允许时，多久之后重试才可能被允许
+	RetryAfter time.Duration
+}
+
+var (
+	errTooManyRequested = errors.New("requested more than the limit")
+	errInvalidRequested = errors.New("invalid permits")
+	errInvalidLimiter   = errors.New("invalid rate limiter config")
+)
+
+// KEYS: bucket; ARGV: rate(每毫秒补充的令牌数), burst, n
+var tokenBucketScript = redis.NewScript(luaNow + `
+	local rate = tonumber(ARGV[1])
+	local burst = tonumber(ARGV[2])
+	local n = tonumber(ARGV[3])
+
+	local state = redis.call("hmget", KEYS[1], "tokens", "ts")
+	local tokens = tonumber(state[1]) or burst
+	local ts = tonumber(state[2]) or now
+	tokens = math.min(burst, tokens + math.max(0, now - ts) * rate)
+
+	local allowed, retry = 0, 0
+	if tokens >= n
+	then
+		tokens = tokens - n
+		allowed = 1
+	else
+		retry = math.ceil((n - tokens) / rate)
+	end
+	redis.call("hmset", KEYS[1], "tokens", tokens, "ts", now)
+	redis.call("pexpire", KEYS[1], math.ceil(burst / rate))
+	return {allowed, math.floor(tokens), retry}
+`)
+
+// KEYS: log; ARGV: window(毫秒), limit, n, request id
+var slidingWindowScript = redis.NewScript(luaNow + `
+	local window = tonumber(ARGV[1])
+	local limit = tonumber(ARGV[2])
+	local n = tonumber(ARGV[3])
+
+	redis.call("zremrangebyscore", KEYS[1], "-inf", now - window)
+	local count = redis.call("zcard", KEYS[1])
+	if count + n <= limit
+	then
+		for i = 1, n do
+			redis.call("zadd", KEYS[1], now, ARGV[4] .. ":" .. i)
+		end
+		redis.call("pexpire", KEYS[1], window)
+		return {1, limit - count - n, 0}
+	end
+
+	-- 等到足够多的旧请求移出窗口
+	local need = count + n - limit
+	local oldest = redis.call("zrange", KEYS[1], need - 1, need - 1, "withscores")
+	return {0, math.max(0, limit - count), tonumber(oldest[2]) + window - now}
+`)
+
+// TokenBucket 令牌桶限流
+type TokenBucket struct {
+	// Rate 每秒补充的令牌数
+	Rate float64
+	// Burst 桶的容量，即允许的最大突发请求数
+	Burst int64
+
+	client redis.UniversalClient
+}
+
+// NewTokenBucket 创建令牌桶，rate为每秒补充的令牌数，burst为桶的容量
+func NewTokenBucket(client redis.UniversalClient, rate float64, burst int64) *TokenBucket {
+	return &TokenBucket{Rate: rate, Burst: burst, client: client}
+}
+
+func (tb *TokenBucket) Allow(key string) (*RateLimitResult, error) {
+	return tb.AllowN(key, 1)
+}
+
+// AllowN 一次请求n个令牌，n必须大于0
+func (tb *TokenBucket) AllowN(key string, n int64) (*RateLimitResult, error) {
+	if tb.Rate <= 0 || tb.Burst <= 0 {
+		return nil, errInvalidLimiter
+	}
+	if n <= 0 {
+		return nil, errInvalidRequested
+	}
+	if n > tb.Burst {
+		return nil, errTooManyRequested
+	}
+	rsp, err := tokenBucketScript.Run(tb.client, []string{key}, tb.Rate/1000, tb.Burst, n).Result()
+	if err != nil {
+		return nil, err
+	}
+	return parseRateLimitResult(rsp)
+}
+
+// SlidingWindow 滑动窗口日志限流
+type SlidingWindow struct {
+	// Limit 窗口内允许的最大请求数
+	Limit int64
+	// Window 窗口大小
+	Window time.Duration
+
+	client redis.UniversalClient
+}
+
+// NewSlidingWindow 创建滑动窗口，任意window时间内最多允许limit个请求
+func NewSlidingWindow(client redis.UniversalClient, limit int64, window time.Duration) *SlidingWindow {
+	return &SlidingWindow{Limit: limit, Window: window, client: client}
+}
+
+func (sw *SlidingWindow) Allow(key string) (*RateLimitResult, error) {
+	return sw.AllowN(key, 1)
+}
+
+// AllowN 一次请求n个配额，n必须大于0
+func (sw *SlidingWindow) AllowN(key string, n int64) (*RateLimitResult, error) {
+	if sw.Limit <= 0 || sw.Window.Milliseconds() <= 0 {
+		return nil, errInvalidLimiter
+	}
+	if n <= 0 {
+		return nil, errInvalidRequested
+	}
+	if n > sw.Limit {
+		return nil, errTooManyRequested
+	}
+	rsp, err := slidingWindowScript.Run(sw.client, []string{key},
+		sw.Window.Milliseconds(), sw.Limit, n, uuid.NewString()).Result()
+	if err != nil {
+		return nil, err
+	}
+	return parseRateLimitResult(rsp)
+}
+
+func parseRateLimitResult(rsp interface{}) (*RateLimitResult, error) {
+	vals, ok := rsp.([]interface{})
+	if !ok || len(vals) != 3 {
+		return nil, errors.New("unexpected rate limit result")
+	}
+	var ints [3]int64
+	for i, val := range vals {
+		if ints[i], ok = val.(int64); !ok {
+			return nil, errors.New("unexpected rate limit result")
+		}
+	}
+	return &RateLimitResult{
+		Allowed:    ints[0] == 1,
+		Remaining:  ints[1],
+		RetryAfter: time.Duration(ints[2]) * time.Millisecond,
+	}, nil
+}
@@ -0,0 +1,88 @@
+package redis
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	l, s := newTestLocker(t)
+	now := time.Now()
+	s.SetTime(now)
+	tb := NewTokenBucket(l.Client(), 10, 3)
+
+	for want := int64(2); want >= 0; want-- {
+		rsp, err := tb.Allow("user1")
+		if err != nil || !rsp.Allowed || rsp.Remaining != want {
+			t.Fatalf("Allow = %+v, %v; want allowed with %d remaining", rsp, err, want)
+		}
+	}
+	rsp, err := tb.Allow("user1")
+	if err != nil || rsp.Allowed || rsp.RetryAfter != 100*time.Millisecond {
+		t.Fatalf("Allow when empty = %+v, %v; want retry after 100ms", rsp, err)
+	}
+	if rsp, err := tb.Allow("user2"); err != nil || !rsp.Allowed {
+		t.Fatalf("Allow for another key = %+v, %v; want allowed", rsp, err)
+	}
+
+	s.SetTime(now.Add(200 * time.Millisecond))
+	if rsp, err := tb.AllowN("user1", 2); err != nil || !rsp.Allowed {
+		t.Fatalf("AllowN after refill = %+v, %v; want allowed", rsp, err)
+	}
+}
+
+func TestSlidingWindow(t *testing.T) {
+	l, s := newTestLocker(t)
+	now := time.Now()
+	s.SetTime(now)
+	sw := NewSlidingWindow(l.Client(), 3, time.Second)
+
+	for i := 0; i < 3; i++ {
+		s.SetTime(now.Add(time.Duration(i) * 100 * time.Millisecond))
+		if rsp, err := sw.Allow("ip1"); err != nil || !rsp.Allowed {
+			t.Fatalf("Allow #%d = %+v, %v; want allowed", i, rsp, err)
+		}
+	}
+	rsp, err := sw.Allow("ip1")
+	if err != nil || rsp.Allowed || rsp.RetryAfter != 800*time.Millisecond {
+		t.Fatalf("Allow over limit = %+v, %v; want retry after 800ms", rsp, err)
+	}
+
+	s.SetTime(now.Add(time.Second + time.Millisecond))
+	if rsp, err := sw.Allow("ip1"); err != nil || !rsp.Allowed || rsp.Remaining != 0 {
+		t.Fatalf("Allow after the oldest left the window = %+v, %v", rsp, err)
+	}
+}
+
+func TestRateLimitInvalid(t *testing.T) {
+	l, _ := newTestLocker(t)
+
+	tb := NewTokenBucket(l.Client(), 10, 3)
+	sw := NewSlidingWindow(l.Client(), 3, time.Second)
+	for _, n := range []int64{0, -1} {
+		if _, err := tb.AllowN("tb", n); err != errInvalidRequested {
+			t.Fatalf("TokenBucket.AllowN(%d) = %v, want errInvalidRequested", n, err)
+		}
+		if _, err := sw.AllowN("sw", n); err != errInvalidRequested {
+			t.Fatalf("SlidingWindow.AllowN(%d) = %v, want errInvalidRequested", n, err)
+		}
+	}
+
+	for _, tb := range []*TokenBucket{
+		NewTokenBucket(l.Client(), 0, 3),
+		NewTokenBucket(l.Client(), -1, 3),
+		NewTokenBucket(l.Client(), 10, 0),
+	} {
+		if _, err := tb.Allow("tb"); err != errInvalidLimiter {
+			t.Fatalf("Allow with rate %v burst %d = %v, want errInvalidLimiter", tb.Rate, tb.Burst, err)
+		}
+	}
+	for _, sw := range []*SlidingWindow{
+		NewSlidingWindow(l.Client(), 0, time.Second),
+		NewSlidingWindow(l.Client(), 3, 0),
+	} {
+		if _, err := sw.Allow("sw"); err != errInvalidLimiter {
+			t.Fatalf("Allow with limit %d window %v = %v, want errInvalidLimiter", sw.Limit, sw.Window, err)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+// redis redlock
+/*
+Redlock 算法:
+https://redis.io/docs/manual/patterns/distributed-locks/
+
+1、记录开始时间，并发地在 N 个相互独立的 master 上用相同的 key 和 value 加锁（SET NX PX）
+2、多数节点（N/2+1）加锁成功，并且有效时间 validity = TTL - 加锁耗时 - 时钟漂移 > 0，才认为加锁成功，
+   时钟漂移 = TTL * DriftFactor + 2ms
+3、加锁失败时在所有节点上解锁，包括认为加锁失败的节点（可能已写入但响应超时）
+4、解锁：在所有节点上执行 compare-and-delete lua脚本
+
+注意：每个节点的超时时间（DialTimeout/ReadTimeout）应远小于TTL，避免在宕机节点上阻塞
+*/
+package redis
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+const (
+	defaultDriftFactor = 0.01
+	// 节点之间的时钟精度补偿
+	clockDriftMin = 2 * time.Millisecond
+)
+
+type Redlock struct {
+	// DriftFactor 时钟漂移系数，默认 0.01
+	DriftFactor float64
+
+	lockers []*Locker
+	quorum  int
+}
+
+var errNoRedlockNodes = errors.New("redlock needs at least one node")
+
+// RedlockError 节点出错（而不是锁被他人持有）导致没有达到多数时返回，Errors为出错节点的错误
+type RedlockError struct {
+	Errors []error
+}
+
+func (e *RedlockError) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		msgs = append(msgs, err.Error())
+	}
+	return "redlock: " + strings.Join(msgs, "; ")
+}
+
+func (e *RedlockError) Unwrap() []error {
+	return e.Errors
+}
+
+// NewRedlock clients 为相互独立的master节点，没有节点时加锁、解锁都返回错误
+func NewRedlock(clients ...*redis.Client) *Redlock {
+	lockers := make([]*Locker, 0, len(clients))
+	for _, client := range clients {
+		lockers = append(lockers, NewLockerWithClient(client))
+	}
+	return &Redlock{
+		DriftFactor: defaultDriftFactor,
+		lockers:     lockers,
+		quorum:      len(lockers)/2 + 1,
+	}
+}
+
+// Lock 在多数节点加锁，返回锁的有效时间。
+// 锁被他人持有时返回ErrLocked，节点出错导致没有达到多数时返回*RedlockError
+func (r *Redlock) Lock(key, value string, expiration time.Duration) (time.Duration, error) {
+	if len(r.lockers) == 0 {
+		return 0, errNoRedlockNodes
+	}
+	start := time.Now()
+	n, errs := r.each(func(l *Locker) error {
+		return l.Lock(key, value, expiration)
+	})
+
+	drift := time.Duration(float64(expiration)*r.DriftFactor) + clockDriftMin
+	validity := expiration - time.Since(start) - drift
+	if n >= r.quorum && validity > 0 {
+		return validity, nil
+	}
+
+	r.Unlock(key, value)
+	if n < r.quorum {
+		return 0, r.failure(errs, func(err error) bool { return err == ErrLocked }, ErrLocked)
+	}
+	// 加锁耗时超过了TTL
+	return 0, ErrLockLost
+}
+
+// LockWait 阻塞加锁直到成功或ctx结束，锁被他人持有或加锁超时后随机退避重试，其他错误直接返回
+func (r *Redlock) LockWait(ctx context.Context, key, value string, expiration time.Duration) (time.Duration, error) {
+	delay := minRetryDelay
+	for {
+		validity, err := r.Lock(key, value, expiration)
+		if err == nil {
+			return validity, nil
+		}
+		if err != ErrLocked && err != ErrLockLost {
+			return 0, err
+		}
+
+		timer := time.NewTimer(jitter(delay))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return 0, ctx.Err()
+		case <-timer.C:
+			if delay *= 2; delay > maxRetryDelay {
+				delay = maxRetryDelay
+			}
+		}
+	}
+}
+
+// Unlock 在所有节点上解锁，多数节点解锁成功时返回nil
+func (r *Redlock) Unlock(key, value string) error {
+	if len(r.lockers) == 0 {
+		return errNoRedlockNodes
+	}
+	n, errs := r.each(func(l *Locker) error {
+		return l.Unlock(key, value)
+	})
+	// 多数节点上锁已过期或被他人持有
+	if n < r.quorum {
+		return r.failure(errs, func(err error) bool { return err == ErrNotFound || err == ErrNotOwner }, ErrNotFound)
+	}
+	return nil
+}
+
+// failure 没有达到多数时的错误。expected 判断锁被他人持有、已过期等正常的失败，
+// 这些节点已经足以阻止达到多数时返回fallback，否则是节点出错导致的，返回*RedlockError
+func (r *Redlock) failure(errs []error, expected func(error) bool, fallback error) error {
+	var failed []error
+	n := 0
+	for _, err := range errs {
+		if expected(err) {
+			n++
+		} else {
+			failed = append(failed, err)
+		}
+	}
+	if len(failed) > 0 && len(r.lockers)-n >= r.quorum {
+		return &RedlockError{Errors: failed}
+	}
+	return fallback
+}
+
+// each 并发地在所有节点上执行fn，返回成功的节点数和失败节点的错误
+func (r *Redlock) each(fn func(l *Locker) error) (int, []error) {
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		n    int
+		errs []error
+	)
+	for _, l := range r.lockers {
+		wg.Add(1)
+		go func(l *Locker) {
+			defer wg.Done()
+			err := fn(l)
+			mu.Lock()
+			if err == nil {
+				n++
+			} else {
+				errs = append(errs, err)
+			}
+			mu.Unlock()
+		}(l)
+	}
+	wg.Wait()
+	return n, errs
+}
@@ -0,0 +1,79 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis"
+)
+
+func TestRedlock(t *testing.T) {
+	var (
+		servers []*miniredis.Miniredis
+		clients []*redis.Client
+	)
+	for i := 0; i < 3; i++ {
+		s := miniredis.RunT(t)
+		client := NewClient(&Options{Addr: s.Addr(), DialTimeout: 100 * time.Millisecond})
+		t.Cleanup(func() { client.Close() })
+		servers = append(servers, s)
+		clients = append(clients, client)
+	}
+	r := NewRedlock(clients...)
+
+	validity, err := r.Lock("k", "a", time.Second)
+	if err != nil || validity <= 0 || validity > time.Second {
+		t.Fatalf("Lock = %v, %v", validity, err)
+	}
+	if _, err := r.Lock("k", "b", time.Second); !errors.Is(err, ErrLocked) {
+		t.Fatalf("Lock while held = %v; want %v", err, ErrLocked)
+	}
+	if err := r.Unlock("k", "a"); err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+
+	// 少数节点不可用时仍能加锁
+	servers[0].Close()
+	if _, err := r.Lock("k", "a", time.Second); err != nil {
+		t.Fatalf("Lock with one node down: %v", err)
+	}
+	if err := r.Unlock("k", "a"); err != nil {
+		t.Fatalf("Unlock with one node down: %v", err)
+	}
+
+	// 多数节点不可用时加锁失败，且不残留锁
+	servers[1].Close()
+	_, err = r.Lock("k", "a", time.Second)
+	var nodeErr *RedlockError
+	if !errors.As(err, &nodeErr) || len(nodeErr.Errors) != 2 {
+		t.Fatalf("Lock with majority down = %v; want node errors", err)
+	}
+	if servers[2].Exists("k") {
+		t.Fatal("failed Lock left the key on a healthy node")
+	}
+
+	// 节点出错不是竞争，LockWait直接返回
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := r.LockWait(ctx, "k", "a", time.Second); !errors.As(err, &nodeErr) {
+		t.Fatalf("LockWait with majority down = %v; want node errors", err)
+	}
+}
+
+func TestRedlockNoNodes(t *testing.T) {
+	r := NewRedlock()
+	if _, err := r.Lock("k", "a", time.Second); err != errNoRedlockNodes {
+		t.Fatalf("Lock = %v; want errNoRedlockNodes", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := r.LockWait(ctx, "k", "a", time.Second); err != errNoRedlockNodes {
+		t.Fatalf("LockWait = %v; want errNoRedlockNodes", err)
+	}
+	if err := r.Unlock("k", "a"); err != errNoRedlockNodes {
+		t.Fatalf("Unlock = %v; want errNoRedlockNodes", err)
+	}
+}
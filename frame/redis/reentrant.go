@@ -0,0 +1,146 @@
+// redis reentrant locker
+/*
+可重入锁:
+
+1、锁使用 hash 存储 owner -> 持有次数，同一个 owner 可以多次加锁，每次加锁次数+1并重置过期时间
+2、解锁时次数-1，减到0才删除key并通知等待者；owner 不一致时解锁失败
+3、加锁、解锁、续期都使用lua脚本保证原子性
+
+注意：可重入锁与 Lock/Unlock 的key类型不同（hash/string），同一个key不要混用
+*/
+package redis
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// 返回加锁后的持有次数，被他人持有时返回0
+var reentrantLockScript = redis.NewScript(`
+	if redis.call("exists", KEYS[1]) == 0 or redis.call("hexists", KEYS[1], ARGV[1]) == 1
+	then
+		local count = redis.call("hincrby", KEYS[1], ARGV[1], 1)
+		redis.call("pexpire", KEYS[1], ARGV[2])
+		return count
+	end
+	return 0
+`)
+
+// 返回解锁后剩余的持有次数，不是owner时返回-1，key不存在时返回-2
+var reentrantUnlockScript = redis.NewScript(`
+	if redis.call("exists", KEYS[1]) == 0
+	then
+		return -2
+	end
+	if redis.call("hexists", KEYS[1], ARGV[1]) == 0
+	then
+		return -1
+	end
+	local count = redis.call("hincrby", KEYS[1], ARGV[1], -1)
+	if count > 0
+	then
+		return count
+	end
+	redis.call("del", KEYS[1])
+	redis.call("publish", ARGV[2], "")
+	return 0
+`)
+
+var reentrantExtendScript = redis.NewScript(`
+	if redis.call("hexists", KEYS[1], ARGV[1]) == 1
+	then
+		return redis.call("pexpire", KEYS[1], ARGV[2])
+	end
+	return 0
+`)
+
+// LockReentrant 可重入加锁，返回当前持有次数，expiration至少为1ms
+func (l *Locker) LockReentrant(key, owner string, expiration time.Duration) (int, error) {
+	if err := validReentrantTTL(expiration); err != nil {
+		return 0, err
+	}
+	start := time.Now()
+	count, err := l.lockReentrant(key, owner, expiration)
+	l.observe(key, start, err)
+	return count, err
+}
+
+// validReentrantTTL pexpire 0 会直接删除key，expiration至少为1ms
+func validReentrantTTL(expiration time.Duration) error {
+	if expiration.Milliseconds() <= 0 {
+		return errInvalidTTL
+	}
+	return nil
+}
+
+func (l *Locker) lockReentrant(key, owner string, expiration time.Duration) (int, error) {
+	count, err := reentrantLockScript.Run(l.client, []string{key}, owner, expiration.Milliseconds()).Int()
+	if err != nil {
+		return 0, err
+	}
+	if count == 0 {
+		return 0, ErrLocked
+	}
+	return count, nil
+}
+
+// LockReentrantWait 阻塞可重入加锁直到成功或ctx结束
+func (l *Locker) LockReentrantWait(ctx context.Context, key, owner string, expiration time.Duration) (int, error) {
+	if err := validReentrantTTL(expiration); err != nil {
+		return 0, err
+	}
+	var count int
+	err := l.wait(ctx, key, func() (bool, error) {
+		var err error
+		count, err = l.lockReentrant(key, owner, expiration)
+		if err == ErrLocked {
+			return false, nil
+		}
+		return err == nil, err
+	})
+	return count, err
+}
+
+// UnlockReentrant 可重入解锁，返回剩余持有次数，为0时锁已释放
+func (l *Locker) UnlockReentrant(key, owner string) (int, error) {
+	count, err := reentrantUnlockScript.Run(l.client, []string{key}, owner, releaseChannel(key)).Int()
+	if err == nil {
+		if count == -2 {
+			err = ErrNotFound
+		} else if count < 0 {
+			err = ErrNotOwner
+		}
+	}
+	if err != nil {
+		l.hooks.UnlockFailed(key, err)
+		return 0, err
+	}
+	return count, nil
+}
+
+// ExtendReentrant 只有owner持有锁时才重置过期时间
+func (l *Locker) ExtendReentrant(key, owner string, expiration time.Duration) error {
+	if err := validReentrantTTL(expiration); err != nil {
+		return err
+	}
+	ret, err := reentrantExtendScript.Run(l.client, []string{key}, owner, expiration.Milliseconds()).Int()
+	if err == nil && ret == 0 {
+		err = ErrLockLost
+	}
+	if err != nil {
+		l.hooks.RenewFailed(key, err)
+	}
+	return err
+}
+
+// LockReentrant 使用默认Locker可重入加锁
+func LockReentrant(key, owner string, expiration time.Duration) (int, error) {
+	return defaultLocker.LockReentrant(key, owner, expiration)
+}
+
+// UnlockReentrant 使用默认Locker可重入解锁
+func UnlockReentrant(key, owner string) (int, error) {
+	return defaultLocker.UnlockReentrant(key, owner)
+}
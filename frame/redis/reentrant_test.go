@@ -0,0 +1,58 @@
+package redis
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestReentrant(t *testing.T) {
+	l, s := newTestLocker(t)
+
+	for want := 1; want <= 3; want++ {
+		count, err := l.LockReentrant("k", "a", time.Second)
+		if err != nil || count != want {
+			t.Fatalf("LockReentrant = %d, %v; want %d, nil", count, err, want)
+		}
+	}
+	if _, err := l.LockReentrant("k", "b", time.Second); !errors.Is(err, ErrLocked) {
+		t.Fatalf("LockReentrant by other owner = %v; want %v", err, ErrLocked)
+	}
+	if _, err := l.UnlockReentrant("k", "b"); !errors.Is(err, ErrNotOwner) {
+		t.Fatalf("UnlockReentrant by other owner = %v; want %v", err, ErrNotOwner)
+	}
+	for want := 2; want >= 0; want-- {
+		count, err := l.UnlockReentrant("k", "a")
+		if err != nil || count != want {
+			t.Fatalf("UnlockReentrant = %d, %v; want %d, nil", count, err, want)
+		}
+	}
+	if s.Exists("k") {
+		t.Fatal("key exists after the last UnlockReentrant")
+	}
+	if _, err := l.UnlockReentrant("k", "a"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("UnlockReentrant after release = %v; want %v", err, ErrNotFound)
+	}
+}
+
+func TestReentrantInvalidTTL(t *testing.T) {
+	l, s := newTestLocker(t)
+
+	for _, ttl := range []time.Duration{0, -time.Second, 500 * time.Microsecond} {
+		if _, err := l.LockReentrant("r", "a", ttl); err != errInvalidTTL {
+			t.Fatalf("LockReentrant ttl %v = %v; want errInvalidTTL", ttl, err)
+		}
+	}
+	if s.Exists("r") {
+		t.Fatal("key created with invalid ttl")
+	}
+	if _, err := l.LockReentrant("r", "a", time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.ExtendReentrant("r", "a", 0); err != errInvalidTTL {
+		t.Fatalf("ExtendReentrant ttl 0 = %v; want errInvalidTTL", err)
+	}
+	if _, err := l.LockReentrant("r", "b", time.Second); !errors.Is(err, ErrLocked) {
+		t.Fatalf("LockReentrant by other owner = %v; want %v", err, ErrLocked)
+	}
+}
@@ -0,0 +1,226 @@
+// redis read-write locker
+/*
+读写锁:
+
+1、写锁: string key:write，SET NX PX，与普通锁相同
+2、读锁: zset key:readers，member 为读者 owner，score 为该读者的过期时间（毫秒），
+   每次操作先清理过期的读者，读者崩溃后最多 TTL 就不再阻塞写者
+3、写优先: 写者等待读者释放时登记 key:writer（短过期时间，等待期间不断刷新），
+   有等待的写者时新的读者不能加锁，避免写者饥饿
+4、所有状态转换都在lua脚本中完成，时间使用redis服务器时间，避免客户端时钟不一致
+5、读锁、写锁释放时publish通知，等待者立即重试
+*/
+package redis
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// luaNow redis服务器当前时间（毫秒）
+const luaNow = `
+	redis.replicate_commands()
+	local t = redis.call("time")
+	local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+`
+
+// 等待中的写者需要在该时间内刷新登记，否则新的读者可以继续加锁
+const writerIntentTTL = 4 * maxRetryDelay
+
+// KEYS: write, readers, writer; ARGV: owner, ttl
+var rlockScript = redis.NewScript(luaNow + `
+	if redis.call("exists", KEYS[1]) == 1 or redis.call("exists", KEYS[3]) == 1
+	then
+		return 0
+	end
+	redis.call("zremrangebyscore", KEYS[2], "-inf", now)
+	redis.call("zadd", KEYS[2], now + tonumber(ARGV[2]), ARGV[1])
+	local last = redis.call("zrange", KEYS[2], -1, -1, "withscores")
+	redis.call("pexpire", KEYS[2], tonumber(last[2]) - now)
+	return 1
+`)
+
+// KEYS: readers; ARGV: owner, ttl
+var rextendScript = redis.NewScript(luaNow + `
+	local score = redis.call("zscore", KEYS[1], ARGV[1])
+	if not score or tonumber(score) <= now
+	then
+		return 0
+	end
+	redis.call("zadd", KEYS[1], now + tonumber(ARGV[2]), ARGV[1])
+	local last = redis.call("zrange", KEYS[1], -1, -1, "withscores")
+	redis.call("pexpire", KEYS[1], tonumber(last[2]) - now)
+	return 1
+`)
+
+// KEYS: readers; ARGV: owner, channel
+var runlockScript = redis.NewScript(`
+	if redis.call("zrem", KEYS[1], ARGV[1]) == 0
+	then
+		return 0
+	end
+	if redis.call("zcard", KEYS[1]) == 0
+	then
+		redis.call("publish", ARGV[2], "")
+	end
+	return 1
+`)
+
+// KEYS: write, readers, writer; ARGV: owner, ttl, intent ttl(0表示不登记)
+var wlockScript = redis.NewScript(luaNow + `
+	if redis.call("exists", KEYS[1]) == 1
+	then
+		return 0
+	end
+	local waiting = redis.call("get", KEYS[3])
+	if waiting and waiting ~= ARGV[1]
+	then
+		return 0
+	end
+	redis.call("zremrangebyscore", KEYS[2], "-inf", now)
+	if redis.call("zcard", KEYS[2]) > 0
+	then
+		if tonumber(ARGV[3]) > 0
+		then
+			redis.call("set", KEYS[3], ARGV[1], "px", ARGV[3])
+		end
+		return 0
+	end
+	redis.call("set", KEYS[1], ARGV[1], "px", ARGV[2])
+	if waiting
+	then
+		redis.call("del", KEYS[3])
+	end
+	return 1
+`)
+
+// RWLock 读写锁，同一时间允许多个读者或一个写者
+type RWLock struct {
+	Key string
+	TTL time.Duration
+
+	locker *Locker
+}
+
+// NewRWLock 创建读写锁，expiration为读锁、写锁的过期时间
+func (l *Locker) NewRWLock(key string, expiration time.Duration) *RWLock {
+	return &RWLock{Key: key, TTL: expiration, locker: l}
+}
+
+// validate TTL至少为1ms，pexpire 0 会直接删除key，set px 0 会报错
+func (rw *RWLock) validate() error {
+	if rw.TTL.Milliseconds() <= 0 {
+		return errInvalidTTL
+	}
+	return nil
+}
+
+func (rw *RWLock) keys() []string {
+	return []string{subKey(rw.Key, "write"), subKey(rw.Key, "readers"), subKey(rw.Key, "writer")}
+}
+
+// TryRLock 尝试加读锁
+func (rw *RWLock) TryRLock(owner string) (bool, error) {
+	if err := rw.validate(); err != nil {
+		return false, err
+	}
+	start := time.Now()
+	ok, err := rw.tryRLock(owner)
+	rw.locker.observe(rw.Key, start, lockedErr(ok, err))
+	return ok, err
+}
+
+func (rw *RWLock) tryRLock(owner string) (bool, error) {
+	return rlockScript.Run(rw.locker.client, rw.keys(), owner, rw.TTL.Milliseconds()).Bool()
+}
+
+// RLock 阻塞加读锁直到成功或ctx结束
+func (rw *RWLock) RLock(ctx context.Context, owner string) error {
+	if err := rw.validate(); err != nil {
+		return err
+	}
+	return rw.locker.wait(ctx, rw.Key, func() (bool, error) {
+		return rw.tryRLock(owner)
+	})
+}
+
+// RExtend 重置读锁过期时间
+func (rw *RWLock) RExtend(owner string) error {
+	if err := rw.validate(); err != nil {
+		return err
+	}
+	ok, err := rextendScript.Run(rw.locker.client, rw.keys()[1:2], owner, rw.TTL.Milliseconds()).Bool()
+	if err == nil && !ok {
+		err = ErrLockLost
+	}
+	if err != nil {
+		rw.locker.hooks.RenewFailed(rw.Key, err)
+	}
+	return err
+}
+
+// RUnlock 释放读锁
+func (rw *RWLock) RUnlock(owner string) error {
+	ok, err := runlockScript.Run(rw.locker.client, rw.keys()[1:2], owner, releaseChannel(rw.Key)).Bool()
+	if err == nil && !ok {
+		err = ErrNotFound
+	}
+	if err != nil {
+		rw.locker.hooks.UnlockFailed(rw.Key, err)
+	}
+	return err
+}
+
+// TryLock 尝试加写锁，不登记等待
+func (rw *RWLock) TryLock(owner string) (bool, error) {
+	if err := rw.validate(); err != nil {
+		return false, err
+	}
+	start := time.Now()
+	ok, err := rw.tryLock(owner, 0)
+	rw.locker.observe(rw.Key, start, lockedErr(ok, err))
+	return ok, err
+}
+
+// Lock 阻塞加写锁直到成功或ctx结束，等待期间新的读者不能加锁
+func (rw *RWLock) Lock(ctx context.Context, owner string) error {
+	if err := rw.validate(); err != nil {
+		return err
+	}
+	return rw.locker.wait(ctx, rw.Key, func() (bool, error) {
+		return rw.tryLock(owner, writerIntentTTL)
+	})
+}
+
+func (rw *RWLock) tryLock(owner string, intent time.Duration) (bool, error) {
+	return wlockScript.Run(rw.locker.client, rw.keys(), owner, rw.TTL.Milliseconds(), intent.Milliseconds()).Bool()
+}
+
+// Extend 重置写锁过期时间
+func (rw *RWLock) Extend(owner string) error {
+	if err := rw.validate(); err != nil {
+		return err
+	}
+	ret, err := extendScript.Run(rw.locker.client, rw.keys()[:1], owner, rw.TTL.Milliseconds()).Int()
+	if err == nil && ret == 0 {
+		err = ErrLockLost
+	}
+	if err != nil {
+		rw.locker.hooks.RenewFailed(rw.Key, err)
+	}
+	return err
+}
+
+// Unlock 释放写锁
+func (rw *RWLock) Unlock(owner string) error {
+	ret, err := unlockScript.Run(rw.locker.client, rw.keys()[:1], owner, releaseChannel(rw.Key)).Int()
+	if err == nil {
+		err = unlockResult(ret)
+	}
+	if err != nil {
+		rw.locker.hooks.UnlockFailed(rw.Key, err)
+	}
+	return err
+}
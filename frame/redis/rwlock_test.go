@@ -0,0 +1,99 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRWLock(t *testing.T) {
+	l, _ := newTestLocker(t)
+	rw := l.NewRWLock("k", time.Minute)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for _, reader := range []string{"r1", "r2"} {
+		if ok, err := rw.TryRLock(reader); err != nil || !ok {
+			t.Fatalf("TryRLock(%s) = %v, %v; want true, nil", reader, ok, err)
+		}
+	}
+	if ok, err := rw.TryLock("w"); err != nil || ok {
+		t.Fatalf("TryLock with readers = %v, %v; want false, nil", ok, err)
+	}
+
+	locked := make(chan error, 1)
+	go func() {
+		locked <- rw.Lock(ctx, "w")
+	}()
+	// 等待中的写者阻止新的读者
+	time.Sleep(50 * time.Millisecond)
+	if ok, err := rw.TryRLock("r3"); err != nil || ok {
+		t.Fatalf("TryRLock with waiting writer = %v, %v; want false, nil", ok, err)
+	}
+
+	for _, reader := range []string{"r1", "r2"} {
+		if err := rw.RUnlock(reader); err != nil {
+			t.Fatalf("RUnlock(%s): %v", reader, err)
+		}
+	}
+	if err := <-locked; err != nil {
+		t.Fatalf("Lock: %v", err)
+	}
+	if ok, err := rw.TryRLock("r3"); err != nil || ok {
+		t.Fatalf("TryRLock with writer = %v, %v; want false, nil", ok, err)
+	}
+	if err := rw.Unlock("w"); err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+	if err := rw.RLock(ctx, "r3"); err != nil {
+		t.Fatalf("RLock after writer released: %v", err)
+	}
+	if err := rw.RUnlock("r1"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("RUnlock of released reader = %v; want %v", err, ErrNotFound)
+	}
+}
+
+func TestRWLockExpiredReader(t *testing.T) {
+	l, s := newTestLocker(t)
+	rw := l.NewRWLock("k", time.Second)
+
+	if ok, err := rw.TryRLock("r1"); err != nil || !ok {
+		t.Fatalf("TryRLock = %v, %v; want true, nil", ok, err)
+	}
+	// 读者崩溃，没有释放读锁
+	s.SetTime(time.Now().Add(2 * time.Second))
+	if ok, err := rw.TryLock("w"); err != nil || !ok {
+		t.Fatalf("TryLock after reader expired = %v, %v; want true, nil", ok, err)
+	}
+}
+
+func TestRWLockInvalidTTL(t *testing.T) {
+	l, s := newTestLocker(t)
+	ctx := context.Background()
+
+	for _, ttl := range []time.Duration{0, -time.Second, 500 * time.Microsecond} {
+		rw := l.NewRWLock("k", ttl)
+		if ok, err := rw.TryRLock("r1"); ok || err != errInvalidTTL {
+			t.Fatalf("TryRLock ttl %v = %v, %v; want errInvalidTTL", ttl, ok, err)
+		}
+		if err := rw.RLock(ctx, "r1"); err != errInvalidTTL {
+			t.Fatalf("RLock ttl %v = %v; want errInvalidTTL", ttl, err)
+		}
+		if ok, err := rw.TryLock("w1"); ok || err != errInvalidTTL {
+			t.Fatalf("TryLock ttl %v = %v, %v; want errInvalidTTL", ttl, ok, err)
+		}
+		if err := rw.Lock(ctx, "w1"); err != errInvalidTTL {
+			t.Fatalf("Lock ttl %v = %v; want errInvalidTTL", ttl, err)
+		}
+		if err := rw.RExtend("r1"); err != errInvalidTTL {
+			t.Fatalf("RExtend ttl %v = %v; want errInvalidTTL", ttl, err)
+		}
+		if err := rw.Extend("w1"); err != errInvalidTTL {
+			t.Fatalf("Extend ttl %v = %v; want errInvalidTTL", ttl, err)
+		}
+	}
+	if keys := s.Keys(); len(keys) != 0 {
+		t.Fatalf("keys created with invalid ttl: %v", keys)
+	}
+}
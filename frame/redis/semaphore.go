@@ -0,0 +1,219 @@
+// redis semaphore
+/*
+计数信号量，限制所有节点对某个资源的并发访问数:
+
+1、持有者: zset key:holders，member 为持有者 token，score 为过期时间（毫秒）；hash key:permits 记录每个 token 占用的许可数
+2、等待队列: zset key:queue，score 为 INCR key:seq 得到的排队序号；zset key:waiting 记录等待者的存活期限，
+   等待期间每次重试都会刷新，等待者放弃或崩溃后会被清理
+3、加锁脚本先清理过期的持有者和等待者，只有队首的等待者在剩余许可足够时才能获得许可（公平，先到先得）
+4、Release 删除持有者并publish通知，等待者立即重试
+5、时间使用redis服务器时间
+*/
+package redis
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/google/uuid"
+)
+
+// 等待者需要在该时间内重试，否则被移出队列
+const waiterTTL = 4 * maxRetryDelay
+
+// KEYS: holders, permits, queue, waiting, seq; ARGV: token, n, limit, ttl, waiter ttl(0表示不排队)
+var acquireScript = redis.NewScript(luaNow + `
+	local expired = redis.call("zrangebyscore", KEYS[1], "-inf", now)
+	for _, member in ipairs(expired) do
+		redis.call("hdel", KEYS[2], member)
+	end
+	redis.call("zremrangebyscore", KEYS[1], "-inf", now)
+
+	local gone = redis.call("zrangebyscore", KEYS[4], "-inf", now)
+	for _, member in ipairs(gone) do
+		redis.call("zrem", KEYS[3], member)
+	end
+	redis.call("zremrangebyscore", KEYS[4], "-inf", now)
+
+	local wait = tonumber(ARGV[5])
+	local head
+	if wait > 0
+	then
+		if not redis.call("zscore", KEYS[3], ARGV[1])
+		then
+			redis.call("zadd", KEYS[3], redis.call("incr", KEYS[5]), ARGV[1])
+		end
+		redis.call("zadd", KEYS[4], now + wait, ARGV[1])
+		for _, key in ipairs({KEYS[3], KEYS[4], KEYS[5]}) do
+			redis.call("pexpire", key, wait)
+		end
+		head = redis.call("zrange", KEYS[3], 0, 0)[1]
+	elseif redis.call("zcard", KEYS[3]) == 0
+	then
+		head = ARGV[1]
+	end
+
+	local used = 0
+	for _, permits in ipairs(redis.call("hvals", KEYS[2])) do
+		used = used + tonumber(permits)
+	end
+	local n = tonumber(ARGV[2])
+	if head ~= ARGV[1] or used + n > tonumber(ARGV[3])
+	then
+		return 0
+	end
+
+	if wait > 0
+	then
+		redis.call("zrem", KEYS[3], ARGV[1])
+		redis.call("zrem", KEYS[4], ARGV[1])
+	end
+	redis.call("zadd", KEYS[1], now + tonumber(ARGV[4]), ARGV[1])
+	redis.call("hset", KEYS[2], ARGV[1], n)
+	local last = redis.call("zrange", KEYS[1], -1, -1, "withscores")
+	redis.call("pexpire", KEYS[1], tonumber(last[2]) - now)
+	redis.call("pexpire", KEYS[2], tonumber(last[2]) - now)
+	return 1
+`)
+
+// KEYS: holders, permits; ARGV: token, ttl
+var refreshScript = redis.NewScript(luaNow + `
+	local score = redis.call("zscore", KEYS[1], ARGV[1])
+	if not score or tonumber(score) <= now
+	then
+		return 0
+	end
+	redis.call("zadd", KEYS[1], now + tonumber(ARGV[2]), ARGV[1])
+	local last = redis.call("zrange", KEYS[1], -1, -1, "withscores")
+	redis.call("pexpire", KEYS[1], tonumber(last[2]) - now)
+	redis.call("pexpire", KEYS[2], tonumber(last[2]) - now)
+	return 1
+`)
+
+// KEYS: holders, permits; ARGV: token, channel
+var releaseScript = redis.NewScript(`
+	if redis.call("zrem", KEYS[1], ARGV[1]) == 0
+	then
+		return 0
+	end
+	redis.call("hdel", KEYS[2], ARGV[1])
+	redis.call("publish", ARGV[2], "")
+	return 1
+`)
+
+// Semaphore 计数信号量
+type Semaphore struct {
+	Key string
+	// Limit 许可总数
+	Limit int64
+	// TTL 持有许可的过期时间，超时未Refresh的持有者会被清理
+	TTL time.Duration
+
+	locker *Locker
+}
+
+// Permit 获得的许可
+type Permit struct {
+	Token string
+	N     int64
+}
+
+// NewSemaphore 创建信号量
+func (l *Locker) NewSemaphore(key string, limit int64, expiration time.Duration) *Semaphore {
+	return &Semaphore{Key: key, Limit: limit, TTL: expiration, locker: l}
+}
+
+var errInvalidSemaphore = errors.New("invalid semaphore limit")
+
+// validate Limit必须大于0，TTL至少为1ms，n必须在[1, Limit]之间
+func (s *Semaphore) validate(n int64) error {
+	if s.Limit <= 0 {
+		return errInvalidSemaphore
+	}
+	if s.TTL.Milliseconds() <= 0 {
+		return errInvalidTTL
+	}
+	if n <= 0 || n > s.Limit {
+		return errInvalidRequested
+	}
+	return nil
+}
+
+func (s *Semaphore) keys() []string {
+	return []string{
+		subKey(s.Key, "holders"),
+		subKey(s.Key, "permits"),
+		subKey(s.Key, "queue"),
+		subKey(s.Key, "waiting"),
+		subKey(s.Key, "seq"),
+	}
+}
+
+// TryAcquire 尝试获取n个许可，许可不足或有排队的等待者时返回ErrLocked
+func (s *Semaphore) TryAcquire(n int64) (*Permit, error) {
+	if err := s.validate(n); err != nil {
+		return nil, err
+	}
+	p := &Permit{Token: uuid.NewString(), N: n}
+	start := time.Now()
+	ok, err := s.acquire(p, 0)
+	err = lockedErr(ok, err)
+	s.locker.observe(s.Key, start, err)
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Acquire 阻塞获取n个许可直到成功或ctx结束
+func (s *Semaphore) Acquire(ctx context.Context, n int64) (*Permit, error) {
+	if err := s.validate(n); err != nil {
+		return nil, err
+	}
+	p := &Permit{Token: uuid.NewString(), N: n}
+	err := s.locker.wait(ctx, s.Key, func() (bool, error) {
+		return s.acquire(p, waiterTTL)
+	})
+	if err != nil {
+		// 退出等待队列
+		keys := s.keys()
+		s.locker.client.ZRem(keys[2], p.Token)
+		s.locker.client.ZRem(keys[3], p.Token)
+		return nil, err
+	}
+	return p, nil
+}
+
+func (s *Semaphore) acquire(p *Permit, wait time.Duration) (bool, error) {
+	return acquireScript.Run(s.locker.client, s.keys(),
+		p.Token, p.N, s.Limit, s.TTL.Milliseconds(), wait.Milliseconds()).Bool()
+}
+
+// Refresh 重置许可的过期时间
+func (s *Semaphore) Refresh(p *Permit) error {
+	if s.TTL.Milliseconds() <= 0 {
+		return errInvalidTTL
+	}
+	ok, err := refreshScript.Run(s.locker.client, s.keys()[:2], p.Token, s.TTL.Milliseconds()).Bool()
+	if err == nil && !ok {
+		err = ErrLockLost
+	}
+	if err != nil {
+		s.locker.hooks.RenewFailed(s.Key, err)
+	}
+	return err
+}
+
+// Release 释放许可
+func (s *Semaphore) Release(p *Permit) error {
+	ok, err := releaseScript.Run(s.locker.client, s.keys()[:2], p.Token, releaseChannel(s.Key)).Bool()
+	if err == nil && !ok {
+		err = ErrNotFound
+	}
+	if err != nil {
+		s.locker.hooks.UnlockFailed(s.Key, err)
+	}
+	return err
+}
@@ -0,0 +1,101 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSemaphore(t *testing.T) {
+	l, _ := newTestLocker(t)
+	sem := l.NewSemaphore("k", 3, time.Minute)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	a, err := sem.Acquire(ctx, 2)
+	if err != nil {
+		t.Fatalf("Acquire(2): %v", err)
+	}
+	b, err := sem.TryAcquire(1)
+	if err != nil || b == nil {
+		t.Fatalf("TryAcquire(1) = %v, %v; want permit", b, err)
+	}
+	if p, err := sem.TryAcquire(1); err != ErrLocked || p != nil {
+		t.Fatalf("TryAcquire(1) when exhausted = %v, %v; want nil, ErrLocked", p, err)
+	}
+
+	acquired := make(chan error, 1)
+	go func() {
+		p, err := sem.Acquire(ctx, 2)
+		if err == nil {
+			err = sem.Release(p)
+		}
+		acquired <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	// 有排队的等待者，后来者不能插队
+	if err := sem.Release(b); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+	if p, err := sem.TryAcquire(1); err != ErrLocked || p != nil {
+		t.Fatalf("TryAcquire(1) with waiter queued = %v, %v; want nil, ErrLocked", p, err)
+	}
+
+	if err := sem.Release(a); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+	if err := <-acquired; err != nil {
+		t.Fatalf("queued Acquire: %v", err)
+	}
+	if err := sem.Release(a); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("double Release = %v; want %v", err, ErrNotFound)
+	}
+}
+
+func TestSemaphoreExpiredHolder(t *testing.T) {
+	l, s := newTestLocker(t)
+	sem := l.NewSemaphore("k", 1, time.Second)
+
+	if p, err := sem.TryAcquire(1); err != nil || p == nil {
+		t.Fatalf("TryAcquire = %v, %v; want permit", p, err)
+	}
+	// 持有者崩溃，没有释放许可
+	s.SetTime(time.Now().Add(2 * time.Second))
+	if p, err := sem.TryAcquire(1); err != nil || p == nil {
+		t.Fatalf("TryAcquire after holder expired = %v, %v; want permit", p, err)
+	}
+}
+
+func TestSemaphoreInvalid(t *testing.T) {
+	l, r := newTestLocker(t)
+	ctx := context.Background()
+
+	for _, tc := range []struct {
+		limit int64
+		ttl   time.Duration
+		n     int64
+		want  error
+	}{
+		{1, 0, 1, errInvalidTTL},
+		{1, 500 * time.Microsecond, 1, errInvalidTTL},
+		{0, time.Second, 1, errInvalidSemaphore},
+		{-1, time.Second, 1, errInvalidSemaphore},
+		{1, time.Second, 0, errInvalidRequested},
+		{1, time.Second, 2, errInvalidRequested},
+	} {
+		sem := l.NewSemaphore("s", tc.limit, tc.ttl)
+		if _, err := sem.TryAcquire(tc.n); err != tc.want {
+			t.Fatalf("TryAcquire(%d) limit %d ttl %v = %v; want %v", tc.n, tc.limit, tc.ttl, err, tc.want)
+		}
+		if _, err := sem.Acquire(ctx, tc.n); err != tc.want {
+			t.Fatalf("Acquire(%d) limit %d ttl %v = %v; want %v", tc.n, tc.limit, tc.ttl, err, tc.want)
+		}
+	}
+	if err := l.NewSemaphore("s", 1, 0).Refresh(&Permit{Token: "t", N: 1}); err != errInvalidTTL {
+		t.Fatalf("Refresh ttl 0 = %v; want errInvalidTTL", err)
+	}
+	if keys := r.Keys(); len(keys) != 0 {
+		t.Fatalf("keys created with invalid config: %v", keys)
+	}
+}
@@ -0,0 +1,206 @@
+// redis stream consumer
+/*
+Redis Streams 消费者组:
+https://redis.io/docs/data-types/streams/
+
+1、XREADGROUP 读取新消息，handler 返回nil时 XACK，否则消息留在 pending 列表中等待重试
+2、定期执行 XAUTOCLAIM，把空闲超过 MinIdle 的 pending 消息（handler失败、消费者崩溃）认领到当前消费者重新处理
+3、投递次数超过 MaxDeliveries 的消息写入死信stream（默认 stream:dead）并 XACK，不再重试
+4、ctx 结束后处理完当前消息再退出，已读取但未处理的消息留在 pending 列表中，MinIdle 之后被重新认领
+
+XAUTOCLAIM 需要 Redis >= 6.2
+
+	c := redis.NewConsumer(locker.Client(), "orders", "billing", hostname)
+	err := c.Run(ctx, func(ctx context.Context, msg redis.XMessage) error {
+		return bill(msg.Values)
+	})
+*/
+package redis
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// Consumer 消费者组中的一个消费者
+type Consumer struct {
+	Stream string
+	Group  string
+	// Name 消费者名称，同一个组内唯一
+	Name string
+	// Count 每次读取的最大消息数，默认10
+	Count int64
+	// Block 没有新消息时的阻塞时间，默认1s，也是响应ctx结束的最大延迟
+	Block time.Duration
+	// MinIdle pending消息空闲超过该时间后被重新认领，默认30s
+	MinIdle time.Duration
+	// MaxDeliveries 最大投递次数，超过后写入死信stream，默认5
+	MaxDeliveries int64
+	// DeadLetterStream 死信stream，默认 Stream + ":dead"
+	DeadLetterStream string
+
+	client redis.UniversalClient
+}
+
+// NewConsumer 创建消费者
+func NewConsumer(client redis.UniversalClient, stream, group, name string) *Consumer {
+	return &Consumer{
+		Stream:           stream,
+		Group:            group,
+		Name:             name,
+		Count:            10,
+		Block:            time.Second,
+		MinIdle:          30 * time.Second,
+		MaxDeliveries:    5,
+		DeadLetterStream: stream + ":dead",
+		client:           client,
+	}
+}
+
+// Run 循环消费消息直到ctx结束，消费者组不存在时自动创建
+func (c *Consumer) Run(ctx context.Context, handler func(ctx context.Context, msg redis.XMessage) error) error {
+	err := c.client.XGroupCreateMkStream(c.Stream, c.Group, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return err
+	}
+
+	lastClaim := time.Time{}
+	for ctx.Err() == nil {
+		var msgs []redis.XMessage
+		if time.Since(lastClaim) >= c.MinIdle {
+			if msgs, err = c.claim(); err != nil {
+				return err
+			}
+			lastClaim = time.Now()
+		}
+		if len(msgs) == 0 {
+			if msgs, err = c.read(); err != nil {
+				return err
+			}
+		}
+		for _, msg := range msgs {
+			if ctx.Err() != nil {
+				break
+			}
+			if err := c.handle(ctx, msg, handler); err != nil {
+				return err
+			}
+		}
+	}
+	return ctx.Err()
+}
+
+// read 读取新消息
+func (c *Consumer) read() ([]redis.XMessage, error) {
+	streams, err := c.client.XReadGroup(&redis.XReadGroupArgs{
+		Group:    c.Group,
+		Consumer: c.Name,
+		Streams:  []string{c.Stream, ">"},
+		Count:    c.Count,
+		Block:    c.Block,
+	}).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var msgs []redis.XMessage
+	for _, stream := range streams {
+		msgs = append(msgs, stream.Messages...)
+	}
+	return msgs, nil
+}
+
+// claim 认领空闲超过MinIdle的pending消息，投递次数超限的写入死信stream
+func (c *Consumer) claim() ([]redis.XMessage, error) {
+	cmd := redis.NewCmd("xautoclaim", c.Stream, c.Group, c.Name,
+		c.MinIdle.Milliseconds(), "0-0", "count", c.Count)
+	if err := c.client.Process(cmd); err != nil {
+		return nil, err
+	}
+	claimed, err := parseAutoClaim(cmd.Val())
+	if err != nil {
+		return nil, err
+	}
+
+	msgs := make([]redis.XMessage, 0, len(claimed))
+	for _, msg := range claimed {
+		pending, err := c.client.XPendingExt(&redis.XPendingExtArgs{
+			Stream: c.Stream,
+			Group:  c.Group,
+			Start:  msg.ID,
+			End:    msg.ID,
+			Count:  1,
+		}).Result()
+		if err != nil {
+			return nil, err
+		}
+		if len(pending) > 0 && pending[0].RetryCount > c.MaxDeliveries {
+			if err := c.deadLetter(msg); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs, nil
+}
+
+func (c *Consumer) deadLetter(msg redis.XMessage) error {
+	values := make(map[string]interface{}, len(msg.Values)+1)
+	for k, v := range msg.Values {
+		values[k] = v
+	}
+	values["_id"] = msg.ID
+	err := c.client.XAdd(&redis.XAddArgs{Stream: c.DeadLetterStream, Values: values}).Err()
+	if err != nil {
+		return err
+	}
+	return c.client.XAck(c.Stream, c.Group, msg.ID).Err()
+}
+
+func (c *Consumer) handle(ctx context.Context, msg redis.XMessage, handler func(ctx context.Context, msg redis.XMessage) error) error {
+	// 处理失败的消息留在pending列表中，MinIdle之后重试
+	if err := handler(ctx, msg); err != nil {
+		return nil
+	}
+	return c.client.XAck(c.Stream, c.Group, msg.ID).Err()
+}
+
+// parseAutoClaim 解析 XAUTOCLAIM 的返回值: [next-id, [[id, [field, value, ...]], ...], ...]
+func parseAutoClaim(val interface{}) ([]redis.XMessage, error) {
+	errUnexpected := errors.New("unexpected xautoclaim result")
+	rsp, ok := val.([]interface{})
+	if !ok || len(rsp) < 2 {
+		return nil, errUnexpected
+	}
+	entries, ok := rsp[1].([]interface{})
+	if !ok {
+		return nil, errUnexpected
+	}
+	msgs := make([]redis.XMessage, 0, len(entries))
+	for _, entry := range entries {
+		fields, ok := entry.([]interface{})
+		if !ok || len(fields) != 2 {
+			return nil, errUnexpected
+		}
+		id, _ := fields[0].(string)
+		kvs, ok := fields[1].([]interface{})
+		if !ok {
+			// 已被XDEL删除的消息
+			continue
+		}
+		values := make(map[string]interface{}, len(kvs)/2)
+		for i := 0; i+1 < len(kvs); i += 2 {
+			key, _ := kvs[i].(string)
+			values[key] = kvs[i+1]
+		}
+		msgs = append(msgs, redis.XMessage{ID: id, Values: values})
+	}
+	return msgs, nil
+}
@@ -0,0 +1,92 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+func TestConsumer(t *testing.T) {
+	l, _ := newTestLocker(t)
+	client := l.Client()
+	for _, v := range []string{"ok", "retry", "poison"} {
+		if err := client.XAdd(&redis.XAddArgs{Stream: "s", Values: map[string]interface{}{"v": v}}).Err(); err != nil {
+			t.Fatalf("XAdd: %v", err)
+		}
+	}
+
+	c := NewConsumer(client, "s", "g", "c1")
+	c.Block = 10 * time.Millisecond
+	c.MinIdle = 20 * time.Millisecond
+	c.MaxDeliveries = 3
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	deliveries := map[string]int{}
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Run(ctx, func(ctx context.Context, msg redis.XMessage) error {
+			v := msg.Values["v"].(string)
+			deliveries[v]++
+			if v == "poison" || v == "retry" && deliveries[v] == 1 {
+				return errors.New("fail")
+			}
+			return nil
+		})
+	}()
+
+	// 等待poison写入死信stream
+	deadline := time.Now().Add(5 * time.Second)
+	for client.XLen("s:dead").Val() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("Run = %v; want %v", err, context.Canceled)
+	}
+	if deliveries["ok"] != 1 || deliveries["retry"] != 2 || deliveries["poison"] != 3 {
+		t.Fatalf("deliveries = %v", deliveries)
+	}
+
+	dead, err := client.XRange("s:dead", "-", "+").Result()
+	if err != nil || len(dead) != 1 || dead[0].Values["v"] != "poison" {
+		t.Fatalf("dead letters = %v, %v; want the poison message", dead, err)
+	}
+	pending, err := client.XPending("s", "g").Result()
+	if err != nil || pending.Count != 0 {
+		t.Fatalf("pending = %+v, %v; want none", pending, err)
+	}
+}
+
+func TestConsumerStopsOnCancel(t *testing.T) {
+	l, _ := newTestLocker(t)
+	client := l.Client()
+	for i := 0; i < 5; i++ {
+		if err := client.XAdd(&redis.XAddArgs{Stream: "s", Values: map[string]interface{}{"v": i}}).Err(); err != nil {
+			t.Fatalf("XAdd: %v", err)
+		}
+	}
+
+	c := NewConsumer(client, "s", "g", "c1")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	handled := 0
+	err := c.Run(ctx, func(ctx context.Context, msg redis.XMessage) error {
+		handled++
+		cancel()
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Run = %v; want %v", err, context.Canceled)
+	}
+	if handled != 1 {
+		t.Fatalf("handled %d messages after cancel; want 1", handled)
+	}
+	pending, err := client.XPending("s", "g").Result()
+	if err != nil || pending.Count != 4 {
+		t.Fatalf("pending = %+v, %v; want 4 unhandled", pending, err)
+	}
+}
@@ -0,0 +1,94 @@
+// redis lock wait
+/*
+阻塞加锁:
+
+1、先订阅锁的释放通知频道（Unlock 删除key后会publish），再尝试加锁，避免错过通知
+2、加锁失败时等待：收到释放通知立即重试，否则按带随机抖动的指数退避重试
+3、ctx 取消或超时后返回 ctx.Err()
+4、第一次加锁失败时回调 Hooks.OnContention，结束时回调一次 Hooks.OnAcquire（耗时包含等待时间）
+*/
+package redis
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+const (
+	minRetryDelay = 8 * time.Millisecond
+	maxRetryDelay = 512 * time.Millisecond
+)
+
+// releaseChannel 锁释放通知频道
+func releaseChannel(key string) string {
+	return key + ":released"
+}
+
+// LockWait 阻塞加锁直到成功或ctx结束
+func (l *Locker) LockWait(ctx context.Context, key, value string, expiration time.Duration) error {
+	return l.wait(ctx, key, func() (bool, error) {
+		err := l.setNX(key, value, expiration)
+		if err == ErrLocked {
+			return false, nil
+		}
+		if err == nil {
+			l.hold(key, value, expiration)
+		}
+		return err == nil, err
+	})
+}
+
+// wait 重复执行try直到成功、出错或ctx结束，key的释放通知频道收到消息时立即重试
+func (l *Locker) wait(ctx context.Context, key string, try func() (bool, error)) (err error) {
+	start, contended := time.Now(), false
+	defer func() {
+		l.hooks.Acquire(key, time.Since(start), err)
+	}()
+
+	pubsub := l.client.Subscribe(releaseChannel(key))
+	defer pubsub.Close()
+	// 等待订阅生效
+	if _, err := pubsub.Receive(); err != nil {
+		return err
+	}
+	released := pubsub.Channel()
+
+	delay := minRetryDelay
+	for {
+		ok, err := try()
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+		if !contended {
+			contended = true
+			l.hooks.Contention(key)
+		}
+
+		timer := time.NewTimer(jitter(delay))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-released:
+			timer.Stop()
+		case <-timer.C:
+			if delay *= 2; delay > maxRetryDelay {
+				delay = maxRetryDelay
+			}
+		}
+	}
+}
+
+// jitter 返回[d/2, d)之间的随机时间
+func jitter(d time.Duration) time.Duration {
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)))
+}
+
+// LockWait 使用默认Locker阻塞加锁
+func LockWait(ctx context.Context, key, value string, expiration time.Duration) error {
+	return defaultLocker.LockWait(ctx, key, value, expiration)
+}
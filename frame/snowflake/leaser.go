@@ -0,0 +1,211 @@
+package snowflake
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"frame/etcd"
+	"frame/redis"
+
+	"github.com/google/uuid"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+var ErrNoWorkerID = errors.New("snowflake: no free worker id")
+
+// holder worker id 持有者的标识，便于排查
+func holder() string {
+	hostname, _ := os.Hostname()
+	return hostname + "/" + uuid.NewString()
+}
+
+// EtcdLeaser 使用etcd租用 worker id: Prefix/<id> 绑定在lease上，每隔TTL/3续约一次，进程退出或lease过期后自动释放
+type EtcdLeaser struct {
+	Prefix string
+	// TTL lease的过期时间（秒）
+	TTL int
+
+	client *etcd.Client
+	lease  clientv3.LeaseID
+	key    string
+	// deadline 最后一次成功续约的发送时间 + lease TTL（UnixNano）
+	deadline int64
+
+	stopOnce sync.Once
+	stop     chan struct{}
+	stopped  chan struct{}
+	lost     chan struct{}
+}
+
+// NewEtcdLeaser 创建etcd leaser，client为nil时使用默认client
+func NewEtcdLeaser(client *etcd.Client, prefix string, ttl int) *EtcdLeaser {
+	if client == nil {
+		client = etcd.Default()
+	}
+	return &EtcdLeaser{
+		Prefix:  prefix,
+		TTL:     ttl,
+		client:  client,
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+		lost:    make(chan struct{}),
+	}
+}
+
+// Acquire 依次尝试 0~MaxWorkerID，通过事务创建第一个不存在的key，ctx只用于创建lease和事务
+func (l *EtcdLeaser) Acquire(ctx context.Context) (int64, error) {
+	if l.client.Client == nil {
+		return 0, etcd.ErrClientNotInit
+	}
+	if l.TTL <= 0 {
+		return 0, errors.New("snowflake: invalid ttl")
+	}
+	sent := time.Now()
+	lease, err := l.client.Grant(ctx, int64(l.TTL))
+	if err != nil {
+		return 0, err
+	}
+	value := holder()
+	for id := int64(0); id <= MaxWorkerID; id++ {
+		key := l.Prefix + "/" + strconv.FormatInt(id, 10)
+		rsp, err := l.client.Txn(ctx).
+			If(clientv3.Compare(clientv3.CreateRevision(key), "=", 0)).
+			Then(clientv3.OpPut(key, value, clientv3.WithLease(lease.ID))).
+			Commit()
+		if err != nil {
+			l.revoke(lease.ID)
+			return 0, err
+		}
+		if rsp.Succeeded {
+			l.lease, l.key = lease.ID, key
+			atomic.StoreInt64(&l.deadline, sent.Add(time.Duration(lease.TTL)*time.Second).UnixNano())
+			go l.keepAlive()
+			return id, nil
+		}
+	}
+	l.revoke(lease.ID)
+	return 0, ErrNoWorkerID
+}
+
+func (l *EtcdLeaser) keepAlive() {
+	defer close(l.stopped)
+
+	ticker := time.NewTicker(time.Duration(l.TTL) * time.Second / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			sent := time.Now()
+			ctx, cancel := context.WithDeadline(context.Background(), l.Deadline())
+			rsp, err := l.client.KeepAliveOnce(ctx, l.lease)
+			cancel()
+			if err == nil {
+				atomic.StoreInt64(&l.deadline, sent.Add(time.Duration(rsp.TTL)*time.Second).UnixNano())
+				continue
+			}
+			// 网络等错误下次重试，lease不存在或超过deadline则认为已丢失
+			if err == rpctypes.ErrLeaseNotFound || !time.Now().Before(l.Deadline()) {
+				close(l.lost)
+				return
+			}
+		}
+	}
+}
+
+func (l *EtcdLeaser) revoke(lease clientv3.LeaseID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(l.TTL)*time.Second)
+	defer cancel()
+	_, err := l.client.Revoke(ctx, lease)
+	return err
+}
+
+// Lost lease过期或续约失败时关闭
+func (l *EtcdLeaser) Lost() <-chan struct{} {
+	return l.lost
+}
+
+// Deadline 最后一次成功续约的发送时间 + TTL
+func (l *EtcdLeaser) Deadline() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&l.deadline))
+}
+
+// Release 停止续约，删除key并撤销lease
+func (l *EtcdLeaser) Release(ctx context.Context) error {
+	if l.key == "" {
+		return nil
+	}
+	l.stopOnce.Do(func() {
+		close(l.stop)
+	})
+	<-l.stopped
+	_, err := l.client.Delete(ctx, l.key)
+	if rerr := l.revoke(l.lease); err == nil && rerr != rpctypes.ErrLeaseNotFound {
+		err = rerr
+	}
+	return err
+}
+
+// RedisLeaser 使用redis租用 worker id: Prefix:<id> 由看门狗（Lease）自动续期
+type RedisLeaser struct {
+	Prefix string
+	TTL    time.Duration
+
+	locker *redis.Locker
+	lease  *redis.Lease
+}
+
+// NewRedisLeaser 创建redis leaser，locker为nil时使用默认Locker
+func NewRedisLeaser(locker *redis.Locker, prefix string, ttl time.Duration) *RedisLeaser {
+	if locker == nil {
+		locker = redis.GetDefaultLocker()
+	}
+	return &RedisLeaser{Prefix: prefix, TTL: ttl, locker: locker}
+}
+
+// Acquire 依次尝试 0~MaxWorkerID，对第一个未被持有的key加锁
+func (l *RedisLeaser) Acquire(ctx context.Context) (int64, error) {
+	value := holder()
+	for id := int64(0); id <= MaxWorkerID; id++ {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+		key := fmt.Sprintf("%s:%d", l.Prefix, id)
+		lease, err := l.locker.Obtain(key, value, l.TTL)
+		if err == redis.ErrLocked {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		l.lease = lease
+		return id, nil
+	}
+	return 0, ErrNoWorkerID
+}
+
+// Lost 续期失败、key被删除或被他人持有时关闭
+func (l *RedisLeaser) Lost() <-chan struct{} {
+	return l.lease.Lost()
+}
+
+// Deadline 最后一次成功续期的发送时间 + TTL
+func (l *RedisLeaser) Deadline() time.Time {
+	return l.lease.Deadline()
+}
+
+// Release 停止续期并删除key
+func (l *RedisLeaser) Release(ctx context.Context) error {
+	if l.lease == nil {
+		return nil
+	}
+	return l.lease.Unlock()
+}
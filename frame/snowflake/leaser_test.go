@@ -0,0 +1,77 @@
+package snowflake
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"frame/etcd"
+	"frame/etcd/etcdtest"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+func newTestEtcdClient(t *testing.T) *etcd.Client {
+	client, err := etcd.NewClient(&clientv3.Config{
+		Endpoints:   []string{etcdtest.Start(t)},
+		DialTimeout: 5 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestEtcdLeaser(t *testing.T) {
+	client := newTestEtcdClient(t)
+
+	// Acquire的ctx结束后lease继续续约
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	g1, err := NewGenerator(ctx, NewEtcdLeaser(client, "/snowflake", 2))
+	cancel()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g2, err := NewGenerator(context.Background(), NewEtcdLeaser(client, "/snowflake", 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g1.WorkerID() == g2.WorkerID() {
+		t.Fatalf("both generators got worker id %d", g1.WorkerID())
+	}
+
+	select {
+	case <-g1.Lost():
+		t.Fatal("lease lost after Acquire ctx ended")
+	case <-time.After(3 * time.Second):
+	}
+	if _, err := g1.NextID(); err != nil {
+		t.Fatalf("NextID err = %v", err)
+	}
+
+	// 撤销lease后Lost关闭
+	if _, err := client.Revoke(context.Background(), g2.leaser.(*EtcdLeaser).lease); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-g2.Lost():
+	case <-time.After(3 * time.Second):
+		t.Fatal("lease lost not signaled")
+	}
+	if _, err := g2.NextID(); err != ErrLeaseLost {
+		t.Fatalf("NextID err = %v, want ErrLeaseLost", err)
+	}
+
+	if err := g1.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	g3, err := NewGenerator(context.Background(), NewEtcdLeaser(client, "/snowflake", 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g3.Close(context.Background())
+	if g3.WorkerID() != g1.WorkerID() {
+		t.Fatalf("worker id = %d, want released %d", g3.WorkerID(), g1.WorkerID())
+	}
+}
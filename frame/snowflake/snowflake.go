@@ -0,0 +1,147 @@
+// snowflake id generator
+/*
+Snowflake 分布式唯一ID:
+
+	| 1 bit 符号位 | 41 bits 毫秒时间戳（相对Epoch） | 10 bits worker id | 12 bits 序列号 |
+
+1、worker id 从共享的注册中心租用（etcd key + lease，或 redis key + 自动续期），保证任意时刻不会有两个节点持有同一个 worker id
+2、租约丢失后（网络分区、长时间GC）其他节点可能已经租到同一个 worker id，Generator 停止生成ID，Lost() 关闭，服务应退出或重新创建 Generator
+   续约失败时后台goroutine要等到下一次续约才能发现，因此 Generator 自己检查租约的 Deadline（最后一次成功续约的发送时间 + TTL），
+   距离 Deadline 不足 SafetyMargin 时返回 ErrLeaseExpired，续约成功后恢复
+3、时钟回拨: 回拨不超过 MaxClockBackward 时等待时钟追上，否则返回 ErrClockBackward
+
+	g, err := snowflake.NewGenerator(ctx, snowflake.NewRedisLeaser(locker, "/snowflake/app", 10*time.Second))
+	if err != nil {
+		return err
+	}
+	defer g.Close(ctx)
+	id, err := g.NextID()
+*/
+package snowflake
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	workerBits   = 10
+	sequenceBits = 12
+
+	// MaxWorkerID worker id 的最大值
+	MaxWorkerID = 1<<workerBits - 1
+	maxSequence = 1<<sequenceBits - 1
+	timeShift   = workerBits + sequenceBits
+	workerShift = sequenceBits
+)
+
+// Epoch 时间戳的起始时间，41 bits 可以使用约69年
+var Epoch = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// MaxClockBackward 可以等待的最大时钟回拨
+var MaxClockBackward = 5 * time.Millisecond
+
+// SafetyMargin 距离租约Deadline不足该时间时停止生成ID，用于抵消节点间的时钟频率误差
+var SafetyMargin = 200 * time.Millisecond
+
+var (
+	ErrClockBackward = errors.New("snowflake: clock moved backwards")
+	ErrLeaseLost     = errors.New("snowflake: worker id lease lost")
+	ErrLeaseExpired  = errors.New("snowflake: worker id lease not renewed in time")
+)
+
+// WorkerLeaser 从共享的注册中心租用 worker id
+type WorkerLeaser interface {
+	// Acquire 租用一个未被占用的 worker id，持有期间自动续约
+	Acquire(ctx context.Context) (int64, error)
+	// Lost 租约丢失时关闭
+	Lost() <-chan struct{}
+	// Deadline 租约至少有效到该时间：最后一次成功续约的发送时间 + TTL
+	Deadline() time.Time
+	// Release 释放 worker id
+	Release(ctx context.Context) error
+}
+
+type Generator struct {
+	leaser   WorkerLeaser
+	workerID int64
+
+	mu       sync.Mutex
+	lastTime int64
+	sequence int64
+}
+
+// NewGenerator 租用 worker id 并创建 Generator
+func NewGenerator(ctx context.Context, leaser WorkerLeaser) (*Generator, error) {
+	workerID, err := leaser.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &Generator{leaser: leaser, workerID: workerID}, nil
+}
+
+// WorkerID 当前租用的 worker id
+func (g *Generator) WorkerID() int64 {
+	return g.workerID
+}
+
+// Lost worker id 租约丢失时关闭，之后 NextID 返回 ErrLeaseLost
+func (g *Generator) Lost() <-chan struct{} {
+	return g.leaser.Lost()
+}
+
+// NextID 生成下一个ID
+func (g *Generator) NextID() (int64, error) {
+	select {
+	case <-g.leaser.Lost():
+		return 0, ErrLeaseLost
+	default:
+	}
+	if time.Until(g.leaser.Deadline()) < SafetyMargin {
+		return 0, ErrLeaseExpired
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := since()
+	if now < g.lastTime {
+		backward := time.Duration(g.lastTime-now) * time.Millisecond
+		if backward > MaxClockBackward {
+			return 0, ErrClockBackward
+		}
+		time.Sleep(backward)
+		now = since()
+	}
+
+	if now == g.lastTime {
+		g.sequence = (g.sequence + 1) & maxSequence
+		// 当前毫秒的序列号用完，等待下一毫秒
+		for g.sequence == 0 && now <= g.lastTime {
+			now = since()
+		}
+	} else {
+		g.sequence = 0
+	}
+	g.lastTime = now
+	return now<<timeShift | g.workerID<<workerShift | g.sequence, nil
+}
+
+// Close 释放 worker id
+func (g *Generator) Close(ctx context.Context) error {
+	return g.leaser.Release(ctx)
+}
+
+func since() int64 {
+	return time.Since(Epoch).Milliseconds()
+}
+
+// Parse 解析ID中的时间、worker id和序列号
+func Parse(id int64) (t time.Time, workerID, sequence int64) {
+	t = Epoch.Add(time.Duration(id>>timeShift) * time.Millisecond)
+	workerID = id >> workerShift & MaxWorkerID
+	sequence = id & maxSequence
+	return
+}
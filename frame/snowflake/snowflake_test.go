@@ -0,0 +1,169 @@
+package snowflake
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"frame/redis"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func newTestLeaser(t *testing.T) (*RedisLeaser, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	locker := redis.NewLocker(&redis.Options{Addr: mr.Addr()})
+	return NewRedisLeaser(locker, "snowflake", time.Second), mr
+}
+
+func TestNextID(t *testing.T) {
+	leaser, _ := newTestLeaser(t)
+	g, err := NewGenerator(context.Background(), leaser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close(context.Background())
+
+	seen := make(map[int64]bool)
+	var last int64
+	for i := 0; i < 10000; i++ {
+		id, err := g.NextID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if seen[id] || id <= last {
+			t.Fatalf("id %d not unique or not increasing", id)
+		}
+		seen[id], last = true, id
+	}
+	if _, workerID, _ := Parse(last); workerID != g.WorkerID() {
+		t.Fatalf("worker id = %d, want %d", workerID, g.WorkerID())
+	}
+}
+
+func TestWorkerIDUnique(t *testing.T) {
+	leaser, mr := newTestLeaser(t)
+	locker := redis.NewLocker(&redis.Options{Addr: mr.Addr()})
+
+	g1, err := NewGenerator(context.Background(), leaser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g2, err := NewGenerator(context.Background(), NewRedisLeaser(locker, "snowflake", time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g1.WorkerID() == g2.WorkerID() {
+		t.Fatalf("both generators got worker id %d", g1.WorkerID())
+	}
+
+	// 释放后可以被重新租用
+	g1.Close(context.Background())
+	g3, err := NewGenerator(context.Background(), NewRedisLeaser(locker, "snowflake", time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g3.WorkerID() != g1.WorkerID() {
+		t.Fatalf("worker id = %d, want released %d", g3.WorkerID(), g1.WorkerID())
+	}
+}
+
+func TestLeaseLost(t *testing.T) {
+	leaser, mr := newTestLeaser(t)
+	g, err := NewGenerator(context.Background(), leaser)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mr.Del("snowflake:0")
+	select {
+	case <-g.Lost():
+	case <-time.After(2 * time.Second):
+		t.Fatal("lease lost not signaled")
+	}
+	if _, err := g.NextID(); err != ErrLeaseLost {
+		t.Fatalf("NextID err = %v, want ErrLeaseLost", err)
+	}
+}
+
+func TestClockBackward(t *testing.T) {
+	leaser, _ := newTestLeaser(t)
+	g, err := NewGenerator(context.Background(), leaser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close(context.Background())
+
+	// 小幅回拨等待时钟追上
+	g.lastTime = since() + 2
+	if _, err := g.NextID(); err != nil {
+		t.Fatalf("NextID err = %v, want nil", err)
+	}
+
+	g.lastTime = since() + time.Minute.Milliseconds()
+	if _, err := g.NextID(); err != ErrClockBackward {
+		t.Fatalf("NextID err = %v, want ErrClockBackward", err)
+	}
+}
+
+type fakeLeaser struct {
+	deadline time.Time
+	lost     chan struct{}
+}
+
+func (l *fakeLeaser) Acquire(ctx context.Context) (int64, error) { return 1, nil }
+func (l *fakeLeaser) Lost() <-chan struct{}                      { return l.lost }
+func (l *fakeLeaser) Deadline() time.Time                        { return l.deadline }
+func (l *fakeLeaser) Release(ctx context.Context) error          { return nil }
+
+func TestLeaseDeadline(t *testing.T) {
+	leaser := &fakeLeaser{deadline: time.Now().Add(time.Second), lost: make(chan struct{})}
+	g, err := NewGenerator(context.Background(), leaser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := g.NextID(); err != nil {
+		t.Fatalf("NextID err = %v, want nil", err)
+	}
+
+	// 续约未成功，Lost还没有关闭，但已接近Deadline
+	leaser.deadline = time.Now().Add(SafetyMargin / 2)
+	if _, err := g.NextID(); err != ErrLeaseExpired {
+		t.Fatalf("NextID err = %v, want ErrLeaseExpired", err)
+	}
+
+	// 续约成功后恢复
+	leaser.deadline = time.Now().Add(time.Second)
+	if _, err := g.NextID(); err != nil {
+		t.Fatalf("NextID err = %v, want nil", err)
+	}
+}
+
+func TestRedisLeaserDeadline(t *testing.T) {
+	leaser, mr := newTestLeaser(t)
+	g, err := NewGenerator(context.Background(), leaser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := leaser.Deadline()
+	if time.Until(first) <= 0 || time.Until(first) > time.Second {
+		t.Fatalf("deadline = %v", first)
+	}
+
+	// redis不可用时续期失败，Deadline不再推进
+	mr.Close()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		_, err := g.NextID()
+		if err == ErrLeaseExpired || err == ErrLeaseLost {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("NextID still succeeding after redis is down")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if time.Now().After(leaser.Deadline().Add(-SafetyMargin / 2)) {
+		t.Fatal("generator stopped too late")
+	}
+}